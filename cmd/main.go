@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // user time zones must resolve without system tzdata
 
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/config"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/handler"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/jwtkeys"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/mailer"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/migrate"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/throttle"
+	"github.com/MuhammadrasulGasanov/go-tasks/migrations"
 
 	_ "github.com/lib/pq"
 )
@@ -30,19 +44,153 @@ func main() {
 		log.Fatalf("DB ping error: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(db, os.Args[2:]); err != nil {
+			log.Fatalf("Migrate error: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		if err := runUser(db, os.Args[2:]); err != nil {
+			log.Fatalf("User error: %v", err)
+		}
+		return
+	}
+
+	if cfg.AutoMigrate {
+		m, err := migrate.New(db, migrations.FS)
+		if err != nil {
+			log.Fatalf("Migrate error: %v", err)
+		}
+		applied, err := m.Up(context.Background())
+		if err != nil {
+			log.Fatalf("Migrate error: %v", err)
+		}
+		for _, mig := range applied {
+			log.Printf("Applied migration %03d_%s\n", mig.Version, mig.Name)
+		}
+	}
+
+	keys := jwtkeys.NewHMAC(cfg.JWTSecret)
+	if cfg.JWTSigningAlg != jwtkeys.AlgHS256 {
+		keys, err = jwtkeys.Load(cfg.JWTKeyDir, cfg.JWTSigningAlg, cfg.JWTKeyRotation, cfg.JWTKeyRetention)
+		if err != nil {
+			log.Fatalf("Signing keys error: %v", err)
+		}
+		if cfg.JWTSecret != "" {
+			keys.AcceptHMAC(cfg.JWTSecret)
+		}
+		go keys.Run(context.Background(), time.Minute)
+	}
+
+	var mail mailer.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			log.Fatal("MAILER=smtp requires SMTP_HOST")
+		}
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "memory":
+		mail = mailer.NewMemoryMailer()
+	case "log":
+		mail = mailer.NewLogMailer(cfg.MailFrom)
+	case "file":
+		mail, err = mailer.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+		if err != nil {
+			log.Fatalf("Mailer error: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown MAILER %q", cfg.Mailer)
+	}
+
+	passwordPolicy, err := service.NewPasswordPolicy(cfg.PasswordMinLength, cfg.PasswordBreachList)
+	if err != nil {
+		log.Fatalf("Password policy error: %v", err)
+	}
+
 	//Dependencies
+	loginLimits := service.LoginLimits{
+		Users: throttle.New(throttle.Config{
+			FreeFailures:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			MaxFailures:     cfg.LoginMaxFailures,
+			LockoutDuration: cfg.LoginLockout,
+			Window:          time.Hour,
+		}),
+		IPs: throttle.New(throttle.Config{
+			FreeFailures:    20,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			MaxFailures:     cfg.LoginIPMaxFailures,
+			LockoutDuration: cfg.LoginLockout,
+			Window:          time.Hour,
+		}),
+	}
+	go loginLimits.Users.Run(context.Background(), time.Minute)
+	go loginLimits.IPs.Run(context.Background(), time.Minute)
 	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo)
+	totpRepo := repository.NewTOTPRepository(db)
+	totpService := service.NewTOTPService(userRepo, totpRepo, cfg.TOTPIssuer, loginLimits)
+	totpHandler := handler.NewTOTPHandler(totpService)
+	sessionRepo := repository.NewSessionRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	credentialChecker := service.NewCredentialChecker(totpService, sessionRepo, auditRepo, loginLimits)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(db)
+	emailService := service.NewEmailService(userRepo, emailVerificationRepo, credentialChecker, mail, cfg.EmailVerificationTTL, cfg.PublicURL+"/email/verify")
+	emailHandler := handler.NewEmailHandler(emailService)
+	userService := service.NewUserService(userRepo, passwordPolicy, emailService)
 	userHandler := handler.NewUserHandler(userService)
-	authService := service.NewAuthService(userRepo, cfg.JWTSecret)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	sessionService := service.NewSessionService(sessionRepo)
+	sessionHandler := handler.NewSessionHandler(sessionService)
+	authService := service.NewAuthService(userRepo, refreshTokenRepo, sessionRepo, totpService, auditRepo, loginLimits, keys, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
 	authHandler := handler.NewAuthHandler(authService)
-	taskService := service.NewTaskService(db)
-	taskHandler := handler.NewTaskHandler(taskService)
-	categoryService := service.NewCategoryService(db)
+	taskRepo := repository.NewPostgresTaskRepository(db)
+	categoryRepo := repository.NewPostgresCategoryRepository(db)
+	tagRepo := repository.NewPostgresTagRepository(db)
+	taskService := service.NewTaskService(taskRepo, categoryRepo, tagRepo)
+	tagService := service.NewTagService(tagRepo)
+	tagHandler := handler.NewTagHandler(tagService)
+	preferencesRepo := repository.NewPreferencesRepository(db)
+	profileService := service.NewProfileService(userRepo, preferencesRepo, categoryRepo)
+	profileHandler := handler.NewProfileHandler(profileService)
+	taskHandler := handler.NewTaskHandler(taskService, profileService)
+	categoryService := service.NewCategoryService(categoryRepo)
 	categoryHandler := handler.NewCategoryHandler(categoryService)
+	apiTokenRepo := repository.NewAPITokenRepository(db)
+	apiTokenService := service.NewAPITokenService(apiTokenRepo)
+	apiTokenHandler := handler.NewAPITokenHandler(apiTokenService)
+	searchService := service.NewSearchService(taskRepo, categoryRepo)
+	searchHandler := handler.NewSearchHandler(searchService)
+	adminService := service.NewAdminService(userRepo, taskRepo, refreshTokenRepo, apiTokenRepo, auditRepo, authService)
+	adminHandler := handler.NewAdminHandler(adminService)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	passwordService := service.NewPasswordService(userRepo, passwordResetRepo, refreshTokenRepo, apiTokenRepo, auditRepo, credentialChecker, mail, passwordPolicy, cfg.PasswordResetTTL, cfg.PublicURL+"/password/reset")
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	accountService := service.NewAccountService(userRepo, refreshTokenRepo, credentialChecker, auditRepo, profileService, taskRepo, categoryRepo, tagRepo, cfg.AccountDeletionGrace)
+	accountHandler := handler.NewAccountHandler(accountService)
+	go accountService.RunPurge(context.Background(), time.Hour)
+	var oidcHandler *handler.OIDCHandler
+	if cfg.OIDCIssuer != "" {
+		identityRepo := repository.NewIdentityRepository(db)
+		oidcService, err := service.NewOIDCService(context.Background(), cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, cfg.OIDCScopes, userRepo, identityRepo, auditRepo, authService)
+		if err != nil {
+			log.Fatalf("OIDC provider error: %v", err)
+		}
+		oidcHandler = handler.NewOIDCHandler(oidcService, strings.HasPrefix(cfg.PublicURL, "https://"))
+	}
 
 	//Router
 	r := chi.NewRouter()
+	r.Use(chimiddleware.RequestID)
+	r.Use(chimiddleware.RealIP)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusNotFound, "no route for "+r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		if err := db.Ping(); err != nil {
@@ -52,27 +200,98 @@ func main() {
 		fmt.Fprint(w, "OK")
 	})
 
+	r.Get("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(keys.JWKS())
+	})
+
 	r.Post("/register", userHandler.Register)
 	r.Post("/login", authHandler.Login)
+	r.Post("/login/mfa", authHandler.LoginMFA)
+	r.Post("/token/refresh", authHandler.Refresh)
+	r.Post("/password/forgot", passwordHandler.ForgotPassword)
+	r.Post("/password/reset", passwordHandler.ResetPassword)
+	r.Post("/email/verify", emailHandler.Verify)
+	if oidcHandler != nil {
+		r.Get("/auth/oidc/login", oidcHandler.Login)
+		r.Get("/auth/oidc/callback", oidcHandler.Callback)
+	}
 
 	r.Route("/", func(r chi.Router) {
-		r.Use(middleware.JWTAuthMiddleware(cfg.JWTSecret))
+		r.Use(middleware.AuthMiddleware(middleware.AuthConfig{
+			Keys:      keys,
+			APITokens: apiTokenService,
+			Sessions:  sessionService,
+		}))
+
+		// Account routes, closed to API and impersonation tokens
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(scope.Account))
+			r.Get("/me", profileHandler.GetProfile)
+			r.Patch("/me", profileHandler.UpdateProfile)
+			r.Delete("/me", accountHandler.DeleteAccount)
+			r.Get("/me/export", accountHandler.Export)
+			r.Post("/logout", authHandler.Logout)
+			r.Post("/logout-all", authHandler.LogoutAll)
+			r.Get("/me/sessions", sessionHandler.ListSessions)
+			r.Delete("/me/sessions/{id}", sessionHandler.RevokeSession)
+			r.Put("/me/email", emailHandler.ChangeEmail)
+			r.Post("/me/email/verification", emailHandler.ResendVerification)
+			// Two-factor authentication routes
+			r.Post("/me/2fa/totp", totpHandler.Enroll)
+			r.Post("/me/2fa/totp/confirm", totpHandler.Confirm)
+			r.Delete("/me/2fa/totp", totpHandler.Disable)
+			r.Post("/me/2fa/recovery-codes", totpHandler.RegenerateRecoveryCodes)
+			// API token routes
+			r.With(middleware.RequireVerifiedEmail(emailService)).Post("/me/tokens", apiTokenHandler.CreateToken)
+			r.Get("/me/tokens", apiTokenHandler.ListTokens)
+			r.Delete("/me/tokens/{id}", apiTokenHandler.RevokeToken)
+		})
 
-		r.Get("/me", handler.ProtectedEndpoint)
+		// Also open to the token users get at login after a forced
+		// password reset
+		r.With(middleware.RequireAnyScope(scope.Account, scope.PasswordChange)).Post("/me/password", passwordHandler.ChangePassword)
 
 		// Task routes
-		r.Post("/tasks", taskHandler.CreateTask)
-		r.Get("/tasks", taskHandler.GetTasks)
-		r.Put("/tasks/{id}", taskHandler.UpdateTask)
-		r.Delete("/tasks/{id}", taskHandler.DeleteTask)
-		r.Patch("/tasks/{id}", taskHandler.MarkTaskCompletion)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Post("/tasks", taskHandler.CreateTask)
+		r.With(middleware.RequireScope(scope.TasksRead)).Get("/tasks", taskHandler.GetTasks)
+		r.With(middleware.RequireScope(scope.TasksRead)).Get("/tasks/matrix", taskHandler.GetTaskMatrix)
+		r.With(middleware.RequireScope(scope.TasksRead)).Get("/tasks/{id}", taskHandler.GetTaskByID)
+		r.With(middleware.RequireScope(scope.TasksRead)).Get("/tasks/{id}/subtasks", taskHandler.GetSubtasks)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Put("/tasks/{id}", taskHandler.UpdateTask)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Delete("/tasks/{id}", taskHandler.DeleteTask)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Patch("/tasks/{id}", taskHandler.PatchTask)
 		// Category routes
-		r.Post("/categories", categoryHandler.CreateCategory)
-		r.Get("/categories", categoryHandler.GetCategories)
-		r.Get("/categories/{id}", categoryHandler.GetCategoryById)
-		r.Delete("/categories/{id}", categoryHandler.DeleteCategory)
+		r.With(middleware.RequireScope(scope.CategoriesWrite)).Post("/categories", categoryHandler.CreateCategory)
+		r.With(middleware.RequireScope(scope.CategoriesRead)).Get("/categories", categoryHandler.GetCategories)
+		r.With(middleware.RequireScope(scope.CategoriesRead)).Get("/categories/{id}", categoryHandler.GetCategoryById)
+		r.With(middleware.RequireScope(scope.CategoriesRead, scope.TasksRead)).Get("/categories/{id}/tasks", taskHandler.GetCategoryTasks)
+		r.With(middleware.RequireScope(scope.CategoriesWrite)).Delete("/categories/{id}", categoryHandler.DeleteCategory)
+		// Tag routes
+		r.With(middleware.RequireScope(scope.TasksRead)).Get("/tags", tagHandler.GetTags)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Post("/tags", tagHandler.CreateTag)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Patch("/tags/{id}", tagHandler.UpdateTag)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Delete("/tags/{id}", tagHandler.DeleteTag)
+		r.With(middleware.RequireScope(scope.TasksWrite)).Post("/tags/{id}/merge", tagHandler.MergeTag)
+		// Search routes
+		r.With(middleware.RequireScope(scope.TasksRead, scope.CategoriesRead)).Get("/search", searchHandler.Search)
+
+		// Admin routes
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.RequireAdmin(adminService))
+			r.Get("/users", adminHandler.ListUsers)
+			r.Get("/users/{id}", adminHandler.GetUser)
+			r.Put("/users/{id}/role", adminHandler.SetRole)
+			r.Post("/users/{id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{id}/enable", adminHandler.EnableUser)
+			r.Post("/users/{id}/force-password-reset", adminHandler.ForcePasswordReset)
+			r.Post("/users/{id}/impersonate", adminHandler.Impersonate)
+			r.Get("/stats", adminHandler.Stats)
+			r.Get("/audit", adminHandler.AuditLog)
+		})
 	})
 
 	log.Printf("Server is running on %s\n", cfg.ServerPort)
-	log.Fatal(http.ListenAndServe(""+cfg.ServerPort, r))
+	log.Fatal(http.ListenAndServe(":"+cfg.ServerPort, r))
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const userUsage = `usage: server user <command>
+
+commands:
+  set-role <username> <user|admin>  change the role of a user, e.g. to create the first admin`
+
+func runUser(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", userUsage)
+	}
+
+	users := repository.NewUserRepository(db)
+
+	switch args[0] {
+	case "set-role":
+		if len(args) < 3 {
+			return fmt.Errorf("set-role requires a username and a role")
+		}
+		username, role := args[1], args[2]
+		if role != models.RoleUser && role != models.RoleAdmin {
+			return fmt.Errorf("invalid role %q", role)
+		}
+		user, err := users.GetByUsername(username)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("user %q not found", username)
+		}
+		if err := users.SetRole(user.ID, role); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", username, role)
+		return nil
+	default:
+		return fmt.Errorf("unknown user command %q\n\n%s", args[0], userUsage)
+	}
+}
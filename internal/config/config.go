@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,12 +19,66 @@ type Config struct {
 	DBName     string
 	ServerPort string
 	JWTSecret  string
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// JWTSigningAlg is HS256 (signed with JWTSecret), RS256 or EdDSA. The
+	// asymmetric algorithms read their keys from JWTKeyDir; tokens signed
+	// with JWTSecret keep verifying for as long as it is set.
+	JWTSigningAlg   string
+	JWTKeyDir       string
+	JWTKeyRotation  time.Duration
+	JWTKeyRetention time.Duration
+
+	// PublicURL is where users reach the service, used for links in mail.
+	PublicURL string
+	// Mailer is "smtp", "log", "file" or "memory"; the file mailer writes
+	// to MailDir.
+	Mailer       string
+	MailDir      string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	EmailVerificationTTL time.Duration
+
+	PasswordMinLength int
+	// PasswordBreachList optionally names a file of leaked passwords or
+	// their SHA-1 hashes that may not be used.
+	PasswordBreachList string
+	PasswordResetTTL   time.Duration
+
+	// TOTPIssuer is the name authenticator apps show for the account.
+	TOTPIssuer string
+
+	// Failed logins back off exponentially and lock the username or the
+	// client IP out for LoginLockout after the given number of failures.
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockout       time.Duration
+
+	// AccountDeletionGrace is how long deleted accounts are kept before
+	// they are purged; logging in during that time restores the account.
+	AccountDeletionGrace time.Duration
+
+	// OIDCIssuer enables logging in through an OpenID Connect provider.
+	// OIDCRedirectURL defaults to the callback under PublicURL.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
 }
 
 func LoadConfig() *Config {
 	godotenv.Load()
 
-	return &Config{
+	cfg := &Config{
 		JWTSecret:  os.Getenv("JWT_SECRET"),
 		DBHost:     os.Getenv("DB_HOST"),
 		DBPort:     os.Getenv("DB_PORT"),
@@ -28,10 +86,87 @@ func LoadConfig() *Config {
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:     os.Getenv("DB_NAME"),
 		ServerPort: os.Getenv("SERVER_PORT"),
+
+		AutoMigrate: os.Getenv("AUTO_MIGRATE") == "true",
+
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		JWTSigningAlg:   getString("JWT_SIGNING_ALG", "HS256"),
+		JWTKeyDir:       getString("JWT_KEY_DIR", "keys"),
+		JWTKeyRotation:  getDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		JWTKeyRetention: getDuration("JWT_KEY_RETENTION", 24*time.Hour),
+
+		PublicURL: strings.TrimSuffix(getString("PUBLIC_URL", "http://localhost:"+os.Getenv("SERVER_PORT")), "/"),
+		Mailer:    getString("MAILER", "log"),
+		MailDir:   getString("MAIL_DIR", "mail"),
+		MailFrom:  getString("MAIL_FROM", "go-tasks <no-reply@localhost>"),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getString("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		EmailVerificationTTL: getDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+
+		PasswordMinLength:  getInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordBreachList: os.Getenv("PASSWORD_BREACH_LIST"),
+		PasswordResetTTL:   getDuration("PASSWORD_RESET_TTL", time.Hour),
+
+		TOTPIssuer: getString("TOTP_ISSUER", "go-tasks"),
+
+		LoginMaxFailures:   getInt("LOGIN_MAX_FAILURES", 10),
+		LoginIPMaxFailures: getInt("LOGIN_IP_MAX_FAILURES", 100),
+		LoginLockout:       getDuration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		AccountDeletionGrace: getDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+
+		OIDCIssuer:       os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:       strings.Split(getString("OIDC_SCOPES", "openid,email,profile"), ","),
 	}
+	if cfg.OIDCRedirectURL == "" {
+		cfg.OIDCRedirectURL = cfg.PublicURL + "/auth/oidc/callback"
+	}
+	return cfg
 }
 
 func (c *Config) GetDBConnString() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		c.DBUser, c.DBPassword, c.DBHost, c.DBPort, c.DBName)
 }
+
+func getString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
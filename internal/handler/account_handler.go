@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+// unsafeFilenameChars are replaced in the export's file name.
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+type AccountHandler struct {
+	Service *service.AccountService
+}
+
+func NewAccountHandler(s *service.AccountService) *AccountHandler {
+	return &AccountHandler{Service: s}
+}
+
+// DeleteAccount schedules the account for deletion. It answers 202 because
+// the data is only purged once the grace period is over.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.GetUserIDFromContext(r.Context()); !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	purgeAt, err := h.Service.DeleteAccount(r.Context(), actor(r), input.Password, input.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"deletion_scheduled_at": purgeAt.UTC(),
+	})
+}
+
+// Export downloads the user's data as a ZIP archive of JSON files.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	export, err := h.Service.Export(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Build the archive first so a failure still gets an error response
+	// instead of a truncated download.
+	var buf bytes.Buffer
+	if err := export.WriteZip(&buf); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	name := fmt.Sprintf("go-tasks-%s-%s.zip", export.Profile.Username, export.ExportedAt.Format(time.DateOnly))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, unsafeFilenameChars.ReplaceAllString(name, "_")))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "no-store")
+	buf.WriteTo(w)
+}
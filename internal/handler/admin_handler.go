@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type AdminHandler struct {
+	Service *service.AdminService
+}
+
+func NewAdminHandler(s *service.AdminService) *AdminHandler {
+	return &AdminHandler{Service: s}
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, offset := 0, 0
+	verr := &service.ValidationError{}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			verr.Add("limit", "must be a positive integer")
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			verr.Add("offset", "must be a non-negative integer")
+		}
+		offset = n
+	}
+	if err := verr.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page, err := h.Service.ListUsers(r.Context(), strings.TrimSpace(query.Get("q")), limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.Service.GetUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	user, err := h.Service.SetRole(r.Context(), actor(r), id, input.Role)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.Service.Disable)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.Service.Enable)
+}
+
+func (h *AdminHandler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	h.userAction(w, r, h.Service.ForcePasswordReset)
+}
+
+func (h *AdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	token, user, err := h.Service.Impersonate(r.Context(), actor(r), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(service.ImpersonationTTL.Seconds()),
+		"user":         user,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.Service.Stats(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, err := h.Service.AuditLog(r.Context(), r.URL.Query().Get("action"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (h *AdminHandler) userAction(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, actor service.Actor, id int) error) {
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := action(r.Context(), actor(r), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func actor(r *http.Request) service.Actor {
+	userID, _ := middleware.GetUserIDFromContext(r.Context())
+	a := service.Actor{UserID: userID, IP: clientIP(r), SessionID: middleware.GetSessionIDFromContext(r.Context())}
+	if id, ok := middleware.GetImpersonatorIDFromContext(r.Context()); ok {
+		a.ImpersonatorID = &id
+	}
+	return a
+}
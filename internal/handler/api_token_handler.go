@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type APITokenHandler struct {
+	Service *service.APITokenService
+}
+
+func NewAPITokenHandler(s *service.APITokenService) *APITokenHandler {
+	return &APITokenHandler{Service: s}
+}
+
+func (h *APITokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var input struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt *string  `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil {
+		parsed, err := time.Parse(time.RFC3339, *input.ExpiresAt)
+		if err != nil {
+			writeError(w, r, service.NewValidationError("expires_at", "invalid date format"))
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	raw, token, err := h.Service.CreateToken(r.Context(), userID, middleware.GetScopesFromContext(r.Context()), input.Name, input.Scopes, expiresAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := struct {
+		Token string `json:"token"`
+		*models.APIToken
+	}{Token: raw, APIToken: token}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *APITokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	tokens, err := h.Service.ListTokens(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *APITokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid token ID")
+		return
+	}
+
+	if err := h.Service.RevokeToken(r.Context(), tokenID, userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
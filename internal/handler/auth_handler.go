@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
 )
 
@@ -20,24 +23,128 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	token, user, err := h.AuthService.Login(req.Username, req.Password)
+	result, err := h.AuthService.Login(r.Context(), req.Username, req.Password, clientInfo(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, r, err)
 		return
 	}
+	writeLoginResult(w, result)
+}
 
-	resp := map[string]any{
-		"token":    token,
-		"id":       user.ID,
-		"username": user.Username,
+// LoginMFA exchanges the MFA token from Login and a second factor code for
+// the actual tokens.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		problem.Write(w, r, http.StatusBadRequest, "mfa_token and code are required")
+		return
+	}
+
+	result, err := h.AuthService.CompleteMFA(r.Context(), req.MFAToken, req.Code, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeLoginResult(w, result)
+}
+
+func writeLoginResult(w http.ResponseWriter, result *service.LoginResult) {
+	var resp map[string]any
+	switch {
+	case result.MFAToken != "":
+		resp = map[string]any{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"expires_in":   result.MFAExpiresIn,
+		}
+	case result.PasswordChangeToken != "":
+		resp = map[string]any{
+			"password_change_required": true,
+			"token":                    result.PasswordChangeToken,
+			"token_type":               "Bearer",
+			"expires_in":               result.PasswordChangeExpiresIn,
+			"scope":                    scope.PasswordChange,
+		}
+	default:
+		resp = tokenResponse(result.Tokens)
+		resp["id"] = result.User.ID
+		resp["username"] = result.User.Username
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(resp)
 }
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		problem.Write(w, r, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	tokens, err := h.AuthService.Refresh(r.Context(), req.RefreshToken, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResponse(tokens))
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		problem.Write(w, r, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	if err := h.AuthService.Logout(r.Context(), userID, req.RefreshToken); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := h.AuthService.LogoutAll(r.Context(), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tokenResponse(tokens *service.TokenPair) map[string]any {
+	return map[string]any{
+		"token":         tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    tokens.ExpiresIn,
+		"refresh_token": tokens.RefreshToken,
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
 	"github.com/go-chi/chi/v5"
 )
@@ -22,7 +23,7 @@ func NewCategoryHandler(s *service.CategoryService) *CategoryHandler {
 func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
@@ -31,12 +32,7 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid input", http.StatusBadRequest)
-		return
-	}
-
-	if input.Name == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
 		return
 	}
 
@@ -46,7 +42,7 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err := h.Service.CreateCategory(r.Context(), category); err != nil {
-		http.Error(w, "could not create category", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -56,17 +52,17 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 	idStr := chi.URLParam(r, "id")
 	categoryID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid category ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid category ID")
 		return
 	}
 	if err := h.Service.DeleteCategory(r.Context(), categoryID, userID); err != nil {
-		http.Error(w, "could not delete category", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -75,13 +71,13 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
 	categories, err := h.Service.GetCategoriesByUser(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "could not get categories", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -93,17 +89,21 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 func (h *CategoryHandler) GetCategoryById(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 	idStr := chi.URLParam(r, "id")
 	categoryID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid category ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid category ID")
 		return
 	}
 
 	category, err := h.Service.GetCategoryById(r.Context(), categoryID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(category)
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+// clientIP returns the caller's address without the port. RemoteAddr has
+// already been rewritten from X-Forwarded-For by chi's RealIP middleware.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{IP: clientIP(r), UserAgent: r.UserAgent()}
+}
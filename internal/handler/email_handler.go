@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+type EmailHandler struct {
+	Service *service.EmailService
+}
+
+func NewEmailHandler(s *service.EmailService) *EmailHandler {
+	return &EmailHandler{Service: s}
+}
+
+func (h *EmailHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.GetUserIDFromContext(r.Context()); !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var input struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	user, err := h.Service.ChangeEmail(r.Context(), actor(r), input.Email, input.CurrentPassword, input.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"email":    user.Email,
+		"verified": user.EmailVerified(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *EmailHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if err := h.Service.ResendVerification(r.Context(), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *EmailHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		problem.Write(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	if err := h.Service.Verify(r.Context(), input.Token); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+// writeError maps errors returned by the services to problem responses.
+// Errors it does not know about are logged and reported as 500 without
+// details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *service.ValidationError
+	var rerr *service.RateLimitError
+	switch {
+	case errors.As(err, &verr):
+		problem.WriteValidation(w, r, "one or more fields are invalid", verr.Fields)
+	case errors.As(err, &rerr):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rerr.RetryAfter.Seconds()))))
+		problem.Write(w, r, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, service.ErrValidation):
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrUnauthorized):
+		problem.Write(w, r, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		problem.Write(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrConflict):
+		problem.Write(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrPreconditionFailed):
+		problem.Write(w, r, http.StatusPreconditionFailed, err.Error())
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		problem.Write(w, r, http.StatusInternalServerError, "internal server error")
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+var errPreconditionFailed = errors.New("If-Match does not match the current ETag")
+
+// taskETag is the task's version. Subtask changes leave the version alone,
+// so the progress, when the task has any, is added after it as
+// "version.subtasks.completed".
+func taskETag(task *models.Task) string {
+	tag := strconv.Itoa(task.Version)
+	if p := task.Progress; p != nil {
+		tag += "." + strconv.Itoa(p.Subtasks) + "." + strconv.Itoa(p.Completed)
+	}
+	return `"` + tag + `"`
+}
+
+func setTaskETag(w http.ResponseWriter, task *models.Task) {
+	w.Header().Set("ETag", taskETag(task))
+}
+
+// ifMatchVersion reads the task version required by an If-Match header. It
+// returns nil when any version is acceptable. Weak tags never match, as
+// If-Match uses strong comparison. Only the version part of the tag counts:
+// writes to a task do not conflict with changes to its subtasks.
+func ifMatchVersion(r *http.Request) (*int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	if strings.Contains(header, ",") || strings.HasPrefix(header, "W/") {
+		return nil, errPreconditionFailed
+	}
+	v, _, _ := strings.Cut(strings.Trim(header, `"`), ".")
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, errPreconditionFailed
+	}
+	return &version, nil
+}
+
+// notModified reports whether an If-None-Match header matches the ETag,
+// using weak comparison.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+func TestTaskETagChangesWithProgress(t *testing.T) {
+	task := &models.Task{Version: 3, Progress: models.NewTaskProgress(2, 0)}
+	etag := taskETag(task)
+
+	r := httptest.NewRequest("GET", "/tasks/1", nil)
+	r.Header.Set("If-None-Match", etag)
+	if !notModified(r, etag) {
+		t.Fatalf("If-None-Match %s did not match itself", etag)
+	}
+	task.Progress = models.NewTaskProgress(2, 1)
+	if notModified(r, taskETag(task)) {
+		t.Error("completing a subtask left the ETag unchanged")
+	}
+
+	r = httptest.NewRequest("PATCH", "/tasks/1", nil)
+	r.Header.Set("If-Match", etag)
+	version, err := ifMatchVersion(r)
+	if err != nil || version == nil || *version != 3 {
+		t.Errorf("If-Match %s = %v, %v, want version 3", etag, version, err)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/auth/oidc"
+)
+
+type OIDCHandler struct {
+	Service *service.OIDCService
+	// SecureCookies marks the state cookie Secure; set it when the service
+	// is reached over HTTPS.
+	SecureCookies bool
+}
+
+func NewOIDCHandler(s *service.OIDCService, secureCookies bool) *OIDCHandler {
+	return &OIDCHandler{Service: s, SecureCookies: secureCookies}
+}
+
+// Login redirects to the identity provider. The state travels in a cookie
+// so the callback can tell it is finishing a login this browser started.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	url, stateToken, err := h.Service.AuthCodeURL()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.setStateCookie(w, stateToken, 0)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.setStateCookie(w, "", -1)
+		problem.Write(w, r, http.StatusUnauthorized, "identity provider returned "+providerErr)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if errors.Is(err, http.ErrNoCookie) {
+		writeError(w, r, service.ErrInvalidOIDCState)
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		problem.Write(w, r, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	result, err := h.Service.Callback(r.Context(), cookie.Value, query.Get("state"), code, clientInfo(r))
+	h.setStateCookie(w, "", -1)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeLoginResult(w, result)
+}
+
+// setStateCookie sets the state cookie, or deletes it when maxAge is
+// negative. SameSite=Lax lets it come along on the provider's redirect.
+func (h *OIDCHandler) setStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
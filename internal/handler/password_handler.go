@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+type PasswordHandler struct {
+	Service *service.PasswordService
+}
+
+func NewPasswordHandler(s *service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{Service: s}
+}
+
+func (h *PasswordHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.GetUserIDFromContext(r.Context()); !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		// Code confirms the change for users without a password.
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.Service.ChangePassword(r.Context(), actor(r), input.CurrentPassword, input.NewPassword, input.Code); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword always answers 202 so it cannot be used to find out which
+// accounts exist.
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || (input.Username == "" && input.Email == "") {
+		problem.Write(w, r, http.StatusBadRequest, "username or email is required")
+		return
+	}
+	login := input.Username
+	if login == "" {
+		login = input.Email
+	}
+
+	if err := h.Service.RequestReset(r.Context(), login, clientIP(r)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		problem.Write(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	if err := h.Service.ResetPassword(r.Context(), input.Token, input.NewPassword, clientIP(r)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+type ProfileHandler struct {
+	Service *service.ProfileService
+}
+
+func NewProfileHandler(s *service.ProfileService) *ProfileHandler {
+	return &ProfileHandler{Service: s}
+}
+
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	profile, err := h.Service.GetProfile(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile applies a merge patch to the profile settings. Account
+// fields such as the username or email have their own endpoints.
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		problem.Write(w, r, http.StatusUnsupportedMediaType, "content type must be application/merge-patch+json")
+		return
+	}
+
+	var input struct {
+		DisplayName       models.Optional[string] `json:"display_name"`
+		Timezone          models.Optional[string] `json:"timezone"`
+		Locale            models.Optional[string] `json:"locale"`
+		WeekStart         models.Optional[string] `json:"week_start"`
+		DefaultCategoryID models.Optional[int]    `json:"default_category_id"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	profile, err := h.Service.UpdateProfile(r.Context(), userID, models.PreferencesPatch{
+		DisplayName:       input.DisplayName,
+		Timezone:          input.Timezone,
+		Locale:            input.Locale,
+		WeekStart:         input.WeekStart,
+		DefaultCategoryID: input.DefaultCategoryID,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
@@ -2,59 +2,66 @@ package handler
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
 	"github.com/go-chi/chi/v5"
 )
 
 type TaskHandler struct {
-	Service *service.TaskService
+	Service  *service.TaskService
+	Profiles *service.ProfileService
 }
 
-func NewTaskHandler(s *service.TaskService) *TaskHandler {
-	return &TaskHandler{Service: s}
+func NewTaskHandler(s *service.TaskService, profiles *service.ProfileService) *TaskHandler {
+	return &TaskHandler{Service: s, Profiles: profiles}
 }
 
 func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
 	var input struct {
-		Title       string  `json:"title"`
-		Description *string `json:"description"`
-		CategoryID  *int    `json:"category_id"`
-		DueDate     *string `json:"due_date"`
+		Title       string   `json:"title"`
+		Description *string  `json:"description"`
+		CategoryID  *int     `json:"category_id"`
+		ParentID    *int     `json:"parent_id"`
+		DueDate     *string  `json:"due_date"`
+		Priority    *string  `json:"priority"`
+		Tags        []string `json:"tags"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
 		return
 	}
 
-	if input.Title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
+	prefs, err := h.Profiles.UserPreferences(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	var dueDate *time.Time
-	if input.DueDate != nil {
-		parsed, err := time.Parse(time.RFC3339, *input.DueDate)
-		if err != nil {
-			http.Error(w, "invalid date format", http.StatusBadRequest)
-			return
-		}
-		dueDate = &parsed
+	dueDate, err := parseDueDate(input.DueDate, prefs.Location())
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-
-	if dueDate != nil && dueDate.Before(time.Now()) {
-		http.Error(w, "due date cannot be in the past", http.StatusBadRequest)
+	if input.CategoryID == nil {
+		input.CategoryID = prefs.DefaultCategoryID
+	}
+	priority, err := parsePriority(input.Priority)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -63,14 +70,18 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 		Title:       input.Title,
 		Description: input.Description,
 		CategoryID:  input.CategoryID,
+		ParentID:    input.ParentID,
 		DueDate:     dueDate,
 		Completed:   false,
+		Priority:    priority,
+		Tags:        input.Tags,
 	}
 
 	if err := h.Service.CreateTask(r.Context(), task); err != nil {
-		http.Error(w, "could not create task", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	setTaskETag(w, task)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(task)
 }
@@ -78,74 +89,137 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	categoryIDStr := r.URL.Query().Get("category_id")
-	var categoryID *int
-	if categoryIDStr != "" {
-		id, err := strconv.Atoi(categoryIDStr)
-		if err != nil {
-			http.Error(w, "invalid category_id", http.StatusBadRequest)
-			return
-		}
-		categoryID = &id
+	loc, err := h.location(r, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	filter, err := parseTaskFilter(r, loc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	filter.UserID = userID
 
-	tasks, err := h.Service.GetTasksByUser(r.Context(), userID, categoryID)
+	page, err := h.Service.GetTasksByUser(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "could not get tasks", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	h.writeTaskPage(w, r, userID, page, filter.Limit)
+}
+
+func (h *TaskHandler) GetCategoryTasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	idStr := chi.URLParam(r, "id")
+	categoryID, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid category ID")
+		return
+	}
+
+	loc, err := h.location(r, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	filter, err := parseTaskFilter(r, loc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	filter.UserID = userID
+
+	page, err := h.Service.GetTasksByCategory(r.Context(), categoryID, filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	h.writeTaskPage(w, r, userID, page, filter.Limit)
+}
+
+func (h *TaskHandler) writeTaskPage(w http.ResponseWriter, r *http.Request, userID int, page *service.TaskPage, limit int) {
+	includeCategory, err := parseIncludes(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if includeCategory {
+		if err := h.Service.IncludeCategories(r.Context(), userID, page.Tasks...); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	if err := h.Service.IncludeTags(r.Context(), userID, page.Tasks...); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.Service.IncludeProgress(r.Context(), userID, page.Tasks...); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newTaskListResponse(page, limit))
 }
 
 func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 	idStr := chi.URLParam(r, "id")
 	taskID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid task ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+	ifVersion, err := ifMatchVersion(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusPreconditionFailed, err.Error())
 		return
 	}
 	var input struct {
 		Title       string  `json:"title"`
 		Description *string `json:"description"`
 		CategoryID  *int    `json:"category_id"`
+		ParentID    *int    `json:"parent_id"`
 		DueDate     *string `json:"due_date"`
 		Completed   bool    `json:"completed"`
+		Priority    *string `json:"priority"`
+		// Tags are left as they are when the field is missing.
+		Tags []string `json:"tags"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
 		return
 	}
 
-	if input.Title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
+	loc, err := h.location(r, userID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	var dueDate *time.Time
-	if input.DueDate != nil {
-		parsed, err := time.Parse(time.RFC3339, *input.DueDate)
-		if err != nil {
-			http.Error(w, "invalid date format", http.StatusBadRequest)
-			return
-		}
-		dueDate = &parsed
+	dueDate, err := parseDueDate(input.DueDate, loc)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-
-	if dueDate != nil && dueDate.Before(time.Now()) {
-		http.Error(w, "due date cannot be in the past", http.StatusBadRequest)
+	priority, err := parsePriority(input.Priority)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -155,87 +229,363 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		Title:       input.Title,
 		Description: input.Description,
 		CategoryID:  input.CategoryID,
+		ParentID:    input.ParentID,
 		DueDate:     dueDate,
 		Completed:   input.Completed,
+		Priority:    priority,
+		Tags:        input.Tags,
 	}
 
-	if err := h.Service.UpdateTask(r.Context(), task); err != nil {
-		http.Error(w, "could not update task", http.StatusInternalServerError)
+	if err := h.Service.UpdateTask(r.Context(), task, ifVersion); err != nil {
+		writeError(w, r, err)
 		return
 	}
+	setTaskETag(w, task)
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *TaskHandler) MarkTaskCompletion(w http.ResponseWriter, r *http.Request) {
+// PatchTask applies an RFC 7396 merge patch: only the fields present in the
+// body change, and an explicit null clears a field.
+func (h *TaskHandler) PatchTask(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 	idStr := chi.URLParam(r, "id")
 	taskID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid task ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+	ifVersion, err := ifMatchVersion(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusPreconditionFailed, err.Error())
 		return
 	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		problem.Write(w, r, http.StatusUnsupportedMediaType, "content type must be application/merge-patch+json")
+		return
+	}
+
 	var input struct {
-		Completed bool `json:"completed"`
+		Title       models.Optional[string]   `json:"title"`
+		Description models.Optional[string]   `json:"description"`
+		CategoryID  models.Optional[int]      `json:"category_id"`
+		ParentID    models.Optional[int]      `json:"parent_id"`
+		DueDate     models.Optional[string]   `json:"due_date"`
+		Completed   models.Optional[bool]     `json:"completed"`
+		Priority    models.Optional[string]   `json:"priority"`
+		Tags        models.Optional[[]string] `json:"tags"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid input", http.StatusBadRequest)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
 		return
 	}
-	if err := h.Service.MarkTaskCompletion(r.Context(), taskID, userID, input.Completed); err != nil {
-		http.Error(w, "could not update task completion", http.StatusInternalServerError)
+
+	patch := models.TaskPatch{
+		Title:       input.Title,
+		Description: input.Description,
+		CategoryID:  input.CategoryID,
+		ParentID:    input.ParentID,
+		Completed:   input.Completed,
+		Tags:        input.Tags,
+	}
+	if input.DueDate.Set {
+		loc, err := h.location(r, userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		patch.DueDate.Set = true
+		patch.DueDate.Value, err = parseDueDate(input.DueDate.Value, loc)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	if input.Priority.Set {
+		// Clearing the priority with null sets it back to none.
+		priority, err := parsePriority(input.Priority.Value)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		patch.Priority.Set = true
+		patch.Priority.Value = &priority
+	}
+
+	task, err := h.Service.PatchTask(r.Context(), taskID, userID, patch, ifVersion)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
 
+	setTaskETag(w, task)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
 }
 
 func (h *TaskHandler) GetTaskByID(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
 	idStr := chi.URLParam(r, "id")
 	taskID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid task ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+
+	includeCategory, err := parseIncludes(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	task, err := h.Service.GetTaskByID(r.Context(), taskID, userID)
 	if err != nil {
-		http.Error(w, "task not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
+	setTaskETag(w, task)
+	if notModified(r, taskETag(task)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if includeCategory {
+		if err := h.Service.IncludeCategories(r.Context(), userID, task); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(task)
 }
 
+const (
+	defaultUrgentDays = 2
+	maxUrgentDays     = 30
+)
+
+type taskMatrixResponse struct {
+	UrgentBefore time.Time        `json:"urgent_before"`
+	Limit        int              `json:"limit"`
+	Do           []*models.Task   `json:"do"`
+	Schedule     []*models.Task   `json:"schedule"`
+	Delegate     []*models.Task   `json:"delegate"`
+	Eliminate    []*models.Task   `json:"eliminate"`
+	Totals       taskMatrixTotals `json:"totals"`
+}
+
+// taskMatrixTotals counts the tasks of each quadrant, including those past
+// the limit.
+type taskMatrixTotals struct {
+	Do        int `json:"do"`
+	Schedule  int `json:"schedule"`
+	Delegate  int `json:"delegate"`
+	Eliminate int `json:"eliminate"`
+}
+
+// GetTaskMatrix buckets the user's open tasks into the four quadrants of an
+// Eisenhower matrix, listing at most limit tasks in each. Tasks due before
+// the end of the next urgent_days days in the user's time zone, today being
+// the first, count as urgent.
+func (h *TaskHandler) GetTaskMatrix(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	days := defaultUrgentDays
+	if v := r.URL.Query().Get("urgent_days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUrgentDays {
+			writeError(w, r, service.NewValidationError("urgent_days", "urgent_days must be between 1 and "+strconv.Itoa(maxUrgentDays)))
+			return
+		}
+		days = n
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	includeCategory, err := parseIncludes(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	loc, err := h.location(r, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	y, m, d := time.Now().In(loc).Date()
+	urgentBefore := time.Date(y, m, d+days, 0, 0, 0, 0, loc).UTC()
+
+	matrix, err := h.Service.GetTaskMatrix(r.Context(), userID, urgentBefore, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var tasks []*models.Task
+	for _, quadrant := range []repository.TaskQuadrant{matrix.Do, matrix.Schedule, matrix.Delegate, matrix.Eliminate} {
+		tasks = append(tasks, quadrant.Tasks...)
+	}
+	if includeCategory {
+		if err := h.Service.IncludeCategories(r.Context(), userID, tasks...); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	if err := h.Service.IncludeTags(r.Context(), userID, tasks...); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.Service.IncludeProgress(r.Context(), userID, tasks...); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taskMatrixResponse{
+		UrgentBefore: matrix.UrgentBefore,
+		Limit:        limit,
+		Do:           matrix.Do.Tasks,
+		Schedule:     matrix.Schedule.Tasks,
+		Delegate:     matrix.Delegate.Tasks,
+		Eliminate:    matrix.Eliminate.Tasks,
+		Totals: taskMatrixTotals{
+			Do:        matrix.Do.Total,
+			Schedule:  matrix.Schedule.Total,
+			Delegate:  matrix.Delegate.Total,
+			Eliminate: matrix.Eliminate.Total,
+		},
+	})
+}
+
+// GetSubtasks returns the task as the root of a tree of all its subtasks.
+func (h *TaskHandler) GetSubtasks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	idStr := chi.URLParam(r, "id")
+	taskID, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "invalid task ID")
+		return
+	}
+
+	tree, err := h.Service.GetSubtasks(r.Context(), taskID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
 	idStr := chi.URLParam(r, "id")
 	taskID, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "invalid task ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid task ID")
 		return
 	}
 
-	if err := h.Service.DeleteTask(r.Context(), taskID, userID); err != nil {
-		http.Error(w, "could not delete task", http.StatusInternalServerError)
+	ifVersion, err := ifMatchVersion(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+
+	if err := h.Service.DeleteTask(r.Context(), taskID, userID, ifVersion); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// location returns the time zone the user's due dates are written in.
+func (h *TaskHandler) location(r *http.Request, userID int) (*time.Location, error) {
+	prefs, err := h.Profiles.UserPreferences(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	return prefs.Location(), nil
+}
+
+// parseDueDate parses an optional due date from a request body. A date
+// without a time means the end of that day.
+func parseDueDate(value *string, loc *time.Location) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	parsed, err := parseUserTime(*value, loc, true)
+	if err != nil {
+		return nil, service.NewValidationError("due_date", "invalid date format")
+	}
+	return &parsed, nil
+}
+
+// parsePriority reads an optional priority name from a request body. A
+// missing priority is none.
+func parsePriority(value *string) (models.Priority, error) {
+	if value == nil {
+		return models.PriorityNone, nil
+	}
+	priority, ok := models.ParsePriority(*value)
+	if !ok {
+		return 0, service.NewValidationError("priority", "priority must be one of "+strings.Join(models.PriorityNames(), ", "))
+	}
+	return priority, nil
+}
+
+// parseUserTime reads an RFC 3339 timestamp, or a date-time or date without
+// an offset which is taken to be in loc. A bare date is the start of the
+// day, or its last second when endOfDay is set. The result is in UTC, which
+// is how due dates are stored.
+func parseUserTime(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t.UTC(), nil
+}
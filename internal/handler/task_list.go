@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type pageInfo struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+type taskListResponse struct {
+	Data []*models.Task `json:"data"`
+	Page pageInfo       `json:"page"`
+}
+
+func newTaskListResponse(page *service.TaskPage, limit int) taskListResponse {
+	tasks := page.Tasks
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+	return taskListResponse{
+		Data: tasks,
+		Page: pageInfo{
+			Limit:      limit,
+			NextCursor: page.NextCursor,
+			HasMore:    page.HasMore,
+		},
+	}
+}
+
+// parseIncludes reads the comma separated include parameter and reports
+// whether the category of each task should be embedded.
+func parseIncludes(r *http.Request) (bool, error) {
+	includeCategory := false
+	for _, v := range r.URL.Query()["include"] {
+		for _, inc := range strings.Split(v, ",") {
+			switch strings.TrimSpace(inc) {
+			case "":
+			case "category":
+				includeCategory = true
+			default:
+				return false, service.NewValidationError("include", "include supports only category")
+			}
+		}
+	}
+	return includeCategory, nil
+}
+
+// parseLimit reads the limit query parameter, defaulting to
+// defaultPageSize.
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, service.NewValidationError("limit", "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+	}
+	return limit, nil
+}
+
+// parseTaskFilter reads the pagination, sorting and filtering query
+// parameters of a task listing. Due dates without an offset are read in loc.
+// The user is left for the caller to set.
+func parseTaskFilter(r *http.Request, loc *time.Location) (repository.TaskFilter, error) {
+	q := r.URL.Query()
+	filter := repository.TaskFilter{
+		Sort:       repository.SortCreatedAt,
+		Descending: true,
+		Query:      strings.TrimSpace(q.Get("q")),
+	}
+
+	if v := q.Get("sort"); v != "" {
+		filter.Sort = repository.TaskSort(v)
+		if !filter.Sort.Valid() {
+			return filter, service.NewValidationError("sort", "sort must be one of created_at, due_date, title, priority")
+		}
+		// Newest first and most pressing first are the natural orders for
+		// creation time and priority.
+		filter.Descending = filter.Sort == repository.SortCreatedAt || filter.Sort == repository.SortPriority
+	}
+
+	switch q.Get("order") {
+	case "":
+	case "asc":
+		filter.Descending = false
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, service.NewValidationError("order", "order must be asc or desc")
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit = limit
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := repository.DecodeTaskCursor(v)
+		if err != nil {
+			return filter, service.NewValidationError("cursor", "invalid cursor")
+		}
+		if cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+			return filter, service.NewValidationError("cursor", "cursor does not match the requested sort")
+		}
+		filter.Cursor = cursor
+	}
+
+	if v := q.Get("category_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, service.NewValidationError("category_id", "invalid category_id")
+		}
+		filter.CategoryID = &id
+	}
+
+	if v := q.Get("parent_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, service.NewValidationError("parent_id", "invalid parent_id")
+		}
+		filter.ParentID = &id
+	}
+
+	if v := q.Get("top_level"); v != "" {
+		topLevel, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, service.NewValidationError("top_level", "invalid top_level")
+		}
+		filter.TopLevel = topLevel
+	}
+
+	for _, v := range q["tag"] {
+		if v = strings.TrimSpace(v); v != "" {
+			filter.Tags = append(filter.Tags, v)
+		}
+	}
+
+	switch q.Get("tag_mode") {
+	case "", "all":
+		filter.AllTags = true
+	case "any":
+		filter.AllTags = false
+	default:
+		return filter, service.NewValidationError("tag_mode", "tag_mode must be all or any")
+	}
+
+	if v := q.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, service.NewValidationError("completed", "invalid completed")
+		}
+		filter.Completed = &completed
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, service.NewValidationError("overdue", "invalid overdue")
+		}
+		filter.Overdue = overdue
+	}
+
+	if v := q.Get("due_before"); v != "" {
+		t, err := parseUserTime(v, loc, false)
+		if err != nil {
+			return filter, service.NewValidationError("due_before", "invalid due_before")
+		}
+		filter.DueBefore = &t
+	}
+
+	if v := q.Get("due_after"); v != "" {
+		t, err := parseUserTime(v, loc, false)
+		if err != nil {
+			return filter, service.NewValidationError("due_after", "invalid due_after")
+		}
+		filter.DueAfter = &t
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/middleware"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
+)
+
+type TOTPHandler struct {
+	Service *service.TOTPService
+}
+
+func NewTOTPHandler(s *service.TOTPService) *TOTPHandler {
+	return &TOTPHandler{Service: s}
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Enroll starts setting up an authenticator app. The response carries the
+// otpauth URI and the same URI as a base64 encoded QR code PNG.
+func (h *TOTPHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	enrollment, err := h.Service.Enroll(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+		"qr_png":      base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *TOTPHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	userID, code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.Confirm(r.Context(), userID, code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeRecoveryCodes(w, codes)
+}
+
+func (h *TOTPHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	_, code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Disable(r.Context(), actor(r), code); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TOTPHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	_, code, ok := h.decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(r.Context(), actor(r), code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeRecoveryCodes(w, codes)
+}
+
+func (h *TOTPHandler) decodeCode(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+		return 0, "", false
+	}
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		problem.Write(w, r, http.StatusBadRequest, "code is required")
+		return 0, "", false
+	}
+	return userID, req.Code, true
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{"recovery_codes": codes})
+}
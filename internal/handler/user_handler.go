@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
 )
 
@@ -17,25 +18,27 @@ func NewUserHandler(service *service.UserService) *UserHandler {
 
 type registerRequest struct {
 	Username string `json:"username"`
+	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req registerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "invalid input")
 		return
 	}
 
-	user, err := h.UserService.Register(req.Username, req.Password)
+	user, err := h.UserService.Register(r.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	resp := map[string]any{
 		"id":       user.ID,
 		"username": user.Username,
+		"email":    user.Email,
 	}
 
 	w.Header().Set("Content-type", "application/json")
@@ -0,0 +1,343 @@
+package jwtkeys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// keyIDTimeLayout starts the name of every generated key, so a key's age
+// survives copying the key directory.
+const keyIDTimeLayout = "20060102T150405Z"
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrNoKeys     = errors.New("no signing keys")
+)
+
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+
+	signing   any
+	verifying any
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// Manager holds the keys used to sign and verify JWTs. The newest key signs;
+// every loaded key verifies, so tokens signed before a rotation stay valid
+// until the retired key is pruned.
+type Manager struct {
+	mu   sync.RWMutex
+	keys []*Key
+	// hmac verifies tokens signed with the shared secret before the switch
+	// to asymmetric keys. It never signs.
+	hmac *Key
+
+	dir         string
+	algorithm   string
+	rotateEvery time.Duration
+	retain      time.Duration
+	now         func() time.Time
+}
+
+// NewHMAC returns a manager with a single shared secret. It is kept for
+// deployments that have not moved to asymmetric keys yet.
+func NewHMAC(secret string) *Manager {
+	return &Manager{
+		algorithm: AlgHS256,
+		keys: []*Key{{
+			ID:        "default",
+			Algorithm: AlgHS256,
+			signing:   []byte(secret),
+			verifying: []byte(secret),
+		}},
+	}
+}
+
+// Load reads the PEM encoded private keys in dir. Keys are named after their
+// file and rotated every rotateEvery by writing a new key of the given
+// algorithm; retired keys keep verifying tokens for retain. A zero
+// rotateEvery leaves rotation to whoever manages the directory.
+//
+// A key's age is read from its name, which starts with the time it was
+// created in keyIDTimeLayout, e.g. "20250102T030405Z-1a2b3c4d.pem". Keys
+// named otherwise count as older than any that are, and are never removed.
+func Load(dir, algorithm string, rotateEvery, retain time.Duration) (*Manager, error) {
+	if algorithm != AlgRS256 && algorithm != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		dir:         dir,
+		algorithm:   algorithm,
+		rotateEvery: rotateEvery,
+		retain:      retain,
+		now:         time.Now,
+	}
+	if err := m.start(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manager) start() error {
+	if err := m.reload(); err != nil {
+		return err
+	}
+	if err := m.rotateIfDue(); err != nil {
+		return err
+	}
+	if m.current() == nil {
+		return fmt.Errorf("%w in %s", ErrNoKeys, m.dir)
+	}
+	return nil
+}
+
+// AcceptHMAC keeps verifying tokens signed with the shared secret of
+// NewHMAC, so switching to asymmetric keys does not sign everyone out. The
+// secret can go once the tokens signed with it have expired.
+func (m *Manager) AcceptHMAC(secret string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hmac = &Key{ID: "default", Algorithm: AlgHS256, verifying: []byte(secret)}
+}
+
+// Run reloads the key directory and rotates keys until ctx is done.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	if m.dir == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.reload(); err != nil {
+				log.Printf("Reload signing keys: %v", err)
+				continue
+			}
+			if err := m.rotateIfDue(); err != nil {
+				log.Printf("Rotate signing keys: %v", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) Algorithm() string {
+	return m.algorithm
+}
+
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	key := m.current()
+	if key == nil {
+		return "", ErrNoKeys
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signing)
+}
+
+// Parse verifies the token with the key named by its kid header and decodes
+// it into claims.
+func (m *Manager) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, m.keyfunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
+}
+
+func (m *Manager) keyfunc(token *jwt.Token) (any, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	keys := m.keys
+	if m.hmac != nil {
+		keys = append(slices.Clip(keys), m.hmac)
+	}
+	for _, k := range keys {
+		// Tokens issued before kid headers existed only ever used the
+		// shared secret.
+		match := k.ID == kid || (kid == "" && k.Algorithm == AlgHS256)
+		if match && token.Method.Alg() == k.Algorithm {
+			return k.verifying, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate generates a new signing key and writes it to the key directory.
+func (m *Manager) Rotate() error {
+	if m.dir == "" {
+		return errors.New("rotation needs a key directory")
+	}
+	signer, err := generate(m.algorithm)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	kid := m.now().UTC().Format(keyIDTimeLayout) + "-" + hex.EncodeToString(suffix)
+	path := filepath.Join(m.dir, kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	log.Printf("Generated signing key %s", kid)
+	return m.reload()
+}
+
+func (m *Manager) rotateIfDue() error {
+	key := m.current()
+	if key == nil || (m.rotateEvery > 0 && m.now().Sub(key.CreatedAt) >= m.rotateEvery) {
+		return m.Rotate()
+	}
+	return nil
+}
+
+func (m *Manager) current() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return m.keys[0]
+}
+
+// reload replaces the key set with the keys in the directory, dropping keys
+// that were retired longer than the retention period ago.
+func (m *Manager) reload() error {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	var keys []*Key
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		path := filepath.Join(m.dir, entry.Name())
+		key, err := readKey(path)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", entry.Name(), err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID > keys[j].ID
+	})
+
+	// A key is retired once a newer key exists; it keeps verifying for
+	// the retention period after that.
+	kept := keys[:0]
+	for i, key := range keys {
+		if i > 0 && m.rotateEvery > 0 && !key.CreatedAt.IsZero() && m.now().Sub(keys[i-1].CreatedAt) > m.retain {
+			os.Remove(filepath.Join(m.dir, key.ID+".pem"))
+			continue
+		}
+		kept = append(kept, key)
+	}
+
+	m.mu.Lock()
+	m.keys = kept
+	m.mu.Unlock()
+	return nil
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:      strings.TrimSuffix(filepath.Base(path), ".pem"),
+		signing: parsed,
+	}
+	if stamp, _, ok := strings.Cut(key.ID, "-"); ok {
+		key.CreatedAt, _ = time.Parse(keyIDTimeLayout, stamp)
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgRS256
+		key.verifying = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgEdDSA
+		key.verifying = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+func generate(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
@@ -0,0 +1,175 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestManager loads dir with a clock that only moves through the
+// returned function.
+func newTestManager(t *testing.T, dir, algorithm string) (*Manager, func(time.Duration)) {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &Manager{
+		dir:         dir,
+		algorithm:   algorithm,
+		rotateEvery: 24 * time.Hour,
+		retain:      time.Hour,
+		now:         func() time.Time { return now },
+	}
+	if err := m.start(); err != nil {
+		t.Fatal(err)
+	}
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func sign(t *testing.T, m *Manager) (string, string) {
+	t.Helper()
+	signed, err := m.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return signed, kid
+}
+
+func parses(m *Manager, signed string) bool {
+	_, err := m.Parse(signed, &jwt.RegisteredClaims{})
+	return err == nil
+}
+
+func TestRotation(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			m, advance := newTestManager(t, t.TempDir(), alg)
+			old, oldKid := sign(t, m)
+
+			advance(m.rotateEvery)
+			if err := m.rotateIfDue(); err != nil {
+				t.Fatal(err)
+			}
+			current, kid := sign(t, m)
+			if kid == oldKid {
+				t.Fatalf("still signing with %s after the rotation", kid)
+			}
+			if !parses(m, old) || !parses(m, current) {
+				t.Fatal("tokens signed before and after the rotation should both verify")
+			}
+
+			advance(m.retain + time.Second)
+			if err := m.reload(); err != nil {
+				t.Fatal(err)
+			}
+			if parses(m, old) {
+				t.Error("token of a key retired longer than retain ago still verifies")
+			}
+			if !parses(m, current) {
+				t.Error("token of the current key no longer verifies")
+			}
+			if _, err := os.Stat(filepath.Join(m.dir, oldKid+".pem")); !os.IsNotExist(err) {
+				t.Errorf("retired key file: err = %v, want it removed", err)
+			}
+		})
+	}
+}
+
+// Copying or touching key files must not change which key signs.
+func TestKeyAgeComesFromName(t *testing.T) {
+	m, advance := newTestManager(t, t.TempDir(), AlgEdDSA)
+	_, oldKid := sign(t, m)
+	advance(m.rotateEvery)
+	if err := m.rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	_, kid := sign(t, m)
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(m.dir, oldKid+".pem"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := sign(t, m); got != kid {
+		t.Errorf("signing with %s, want the newest key %s", got, kid)
+	}
+}
+
+func TestAcceptHMAC(t *testing.T) {
+	legacy, _ := sign(t, NewHMAC("secret"))
+
+	m, _ := newTestManager(t, t.TempDir(), AlgRS256)
+	if parses(m, legacy) {
+		t.Fatal("HS256 token verified without the shared secret")
+	}
+	m.AcceptHMAC("secret")
+	if !parses(m, legacy) {
+		t.Error("HS256 token signed before the switch no longer verifies")
+	}
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !parses(m, legacy) {
+		t.Error("HS256 token stopped verifying after a reload")
+	}
+	if _, kid := sign(t, m); kid == "default" {
+		t.Error("the shared secret signed a token")
+	}
+	if len(m.JWKS().Keys) != 1 {
+		t.Errorf("JWKS has %d keys, want only the asymmetric one", len(m.JWKS().Keys))
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	if keys := NewHMAC("secret").JWKS().Keys; len(keys) != 0 {
+		t.Errorf("shared secret published: %+v", keys)
+	}
+
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			m, advance := newTestManager(t, t.TempDir(), alg)
+			advance(m.rotateEvery)
+			if err := m.rotateIfDue(); err != nil {
+				t.Fatal(err)
+			}
+
+			set := m.JWKS()
+			if len(set.Keys) != len(m.keys) {
+				t.Fatalf("JWKS has %d keys, want %d", len(set.Keys), len(m.keys))
+			}
+			for i, jwk := range set.Keys {
+				key := m.keys[i]
+				if jwk.KeyID != key.ID || jwk.Algorithm != alg || jwk.Use != "sig" {
+					t.Errorf("jwk %+v does not describe key %s", jwk, key.ID)
+				}
+				switch pub := key.verifying.(type) {
+				case *rsa.PublicKey:
+					n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+					e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+					if jwk.KeyType != "RSA" || new(big.Int).SetBytes(n).Cmp(pub.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(pub.E) {
+						t.Errorf("jwk %+v does not match the RSA public key", jwk)
+					}
+				case ed25519.PublicKey:
+					x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+					if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || !pub.Equal(ed25519.PublicKey(x)) {
+						t.Errorf("jwk %+v does not match the Ed25519 public key", jwk)
+					}
+				default:
+					t.Fatalf("unexpected key type %T", pub)
+				}
+			}
+		})
+	}
+}
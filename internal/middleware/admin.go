@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+)
+
+// AdminChecker looks up whether a user currently holds the admin role.
+type AdminChecker interface {
+	IsAdmin(ctx context.Context, userID int) (bool, error)
+}
+
+// RequireAdmin lets a request through only when its token carries the admin
+// scope and the user is still an admin, so a demotion applies at once.
+func RequireAdmin(checker AdminChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserIDFromContext(r.Context())
+			if !ok || !scope.Has(GetScopesFromContext(r.Context()), scope.Admin) {
+				problem.Write(w, r, http.StatusForbidden, "admin access required")
+				return
+			}
+			admin, err := checker.IsAdmin(r.Context(), userID)
+			if err != nil {
+				log.Printf("check admin role: %v", err)
+				problem.Write(w, r, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if !admin {
+				problem.Write(w, r, http.StatusForbidden, "admin access required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
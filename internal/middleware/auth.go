@@ -2,56 +2,149 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/jwtkeys"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/service"
 )
 
 type contextKey string
 
-const UserIDKey = contextKey("user_id")
+const (
+	UserIDKey    = contextKey("user_id")
+	ScopesKey    = contextKey("scopes")
+	SessionIDKey = contextKey("session_id")
+	// ImpersonatorIDKey holds the admin behind an impersonation token.
+	ImpersonatorIDKey = contextKey("impersonator_id")
+)
+
+// APITokenVerifier resolves a personal access token to its user and scopes.
+type APITokenVerifier interface {
+	VerifyAPIToken(ctx context.Context, token string) (int, []string, error)
+}
+
+// SessionChecker reports whether the session an access token was issued
+// for is still active.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, sessionID string, userID int) (bool, error)
+}
+
+type AuthConfig struct {
+	Keys      *jwtkeys.Manager
+	APITokens APITokenVerifier
+	Sessions  SessionChecker
+}
 
-func JWTAuthMiddleware(secret string) func(http.Handler) http.Handler {
+// AuthMiddleware accepts either a JWT access token or a personal access token
+// as a bearer token and stores the caller in the request context.
+func AuthMiddleware(cfg AuthConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-tasks"`)
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, "Missing or invalid Authorization header")
 				return
 			}
 
 			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrTokenInvalidClaims
+			var userID int
+			var scopes []string
+			var sessionID string
+			var impersonatorID int
+			if strings.HasPrefix(tokenStr, service.APITokenPrefix) {
+				var err error
+				userID, scopes, err = cfg.APITokens.VerifyAPIToken(r.Context(), tokenStr)
+				if err != nil {
+					if !errors.Is(err, service.ErrUnauthorized) {
+						log.Printf("verify API token: %v", err)
+					}
+					problem.Write(w, r, http.StatusUnauthorized, "Invalid token")
+					return
+				}
+			} else {
+				claims := jwt.MapClaims{}
+				token, err := cfg.Keys.Parse(tokenStr, claims)
+				if err != nil || !token.Valid {
+					problem.Write(w, r, http.StatusUnauthorized, "Invalid token")
+					return
+				}
+				// Tokens issued before the typ claim existed are access tokens.
+				if typ, ok := claims["typ"]; ok && typ != service.TokenTypeAccess {
+					problem.Write(w, r, http.StatusUnauthorized, "Invalid token")
+					return
 				}
-				return []byte(secret), nil
-			})
 
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
+				floatID, ok := claims["user_id"].(float64)
+				if !ok {
+					problem.Write(w, r, http.StatusUnauthorized, "Invalid token claims")
+					return
+				}
+				userID = int(floatID)
+				scopeClaim, _ := claims["scope"].(string)
+				scopes = scope.Parse(scopeClaim)
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok || claims["user_id"] == nil {
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-				return
+				// Impersonation tokens name the admin in the RFC 8693 act
+				// claim.
+				if act, ok := claims["act"].(map[string]any); ok {
+					sub, _ := act["sub"].(float64)
+					if impersonatorID = int(sub); impersonatorID == 0 {
+						problem.Write(w, r, http.StatusUnauthorized, "Invalid token claims")
+						return
+					}
+				}
+
+				// Tokens without a session, such as impersonation tokens,
+				// simply expire.
+				if sessionID, _ = claims["sid"].(string); sessionID != "" {
+					active, err := cfg.Sessions.SessionActive(r.Context(), sessionID, userID)
+					if err != nil {
+						log.Printf("check session: %v", err)
+						problem.Write(w, r, http.StatusInternalServerError, "internal server error")
+						return
+					}
+					if !active {
+						problem.Write(w, r, http.StatusUnauthorized, "Session has been revoked")
+						return
+					}
+				}
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims["user_id"])
+			w.Header().Del("WWW-Authenticate")
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, ScopesKey, scopes)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+			if impersonatorID != 0 {
+				ctx = context.WithValue(ctx, ImpersonatorIDKey, impersonatorID)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
 func GetUserIDFromContext(ctx context.Context) (int, bool) {
-	val := ctx.Value(UserIDKey)
-	floatID, ok := val.(float64)
-	if !ok {
-		return 0, false
-	}
-	return int(floatID), true
+	id, ok := ctx.Value(UserIDKey).(int)
+	return id, ok
+}
+
+// GetSessionIDFromContext returns the session of the access token, or an
+// empty string for API tokens.
+func GetSessionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(SessionIDKey).(string)
+	return id
+}
+
+// GetImpersonatorIDFromContext returns the admin acting as the user when the
+// request carries an impersonation token.
+func GetImpersonatorIDFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(ImpersonatorIDKey).(int)
+	return id, ok
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+)
+
+func GetScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(ScopesKey).([]string)
+	return scopes
+}
+
+// RequireScope rejects requests whose token lacks any of the scopes with
+// 403, as described by RFC 6750.
+func RequireScope(required ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted := GetScopesFromContext(r.Context())
+			for _, s := range required {
+				if !scope.Has(granted, s) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+s+`"`)
+					problem.Write(w, r, http.StatusForbidden, "token is missing the required scope "+s)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAnyScope rejects requests whose token carries none of the scopes
+// with 403.
+func RequireAnyScope(accepted ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted := GetScopesFromContext(r.Context())
+			for _, s := range accepted {
+				if scope.Has(granted, s) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(accepted, " ")+`"`)
+			problem.Write(w, r, http.StatusForbidden, "token is missing one of the scopes "+strings.Join(accepted, ", "))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/problem"
+)
+
+// EmailVerificationChecker looks up whether a user confirmed their email.
+type EmailVerificationChecker interface {
+	IsEmailVerified(ctx context.Context, userID int) (bool, error)
+}
+
+// RequireVerifiedEmail locks a route until the caller verified their email
+// address.
+func RequireVerifiedEmail(checker EmailVerificationChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserIDFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			verified, err := checker.IsEmailVerified(r.Context(), userID)
+			if err != nil {
+				log.Printf("check email verification: %v", err)
+				problem.Write(w, r, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			if !verified {
+				problem.Write(w, r, http.StatusForbidden, "verify your email address to use this feature")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
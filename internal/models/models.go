@@ -1,23 +1,169 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
 type User struct {
 	ID           int       `json:"id"`
 	Username     string    `json:"username"`
-	PasswordHash string    `json:"passwordHash"`
+	Email        string    `json:"email,omitempty"`
+	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"createdAt"`
+	Role         string    `json:"role"`
+	// DisabledAt is set while an admin has disabled the account.
+	DisabledAt *time.Time `json:"disabledAt"`
+	// PasswordResetRequired blocks login until the password is reset.
+	PasswordResetRequired bool       `json:"passwordResetRequired"`
+	EmailVerifiedAt       *time.Time `json:"emailVerifiedAt"`
+	// DeletionRequestedAt is set while the account waits to be purged.
+	DeletionRequestedAt *time.Time `json:"deletionRequestedAt,omitempty"`
+}
+
+func (u *User) EmailVerified() bool {
+	return u.Email != "" && u.EmailVerifiedAt != nil
+}
+
+// HasPassword is false for accounts created through an identity provider
+// that never set a password.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// UserPreferences are the settings a user keeps in their profile. Users
+// that never saved any get DefaultPreferences.
+type UserPreferences struct {
+	DisplayName       *string `json:"display_name"`
+	Timezone          string  `json:"timezone"`
+	Locale            string  `json:"locale"`
+	WeekStart         string  `json:"week_start"`
+	DefaultCategoryID *int    `json:"default_category_id"`
+}
+
+func DefaultPreferences() *UserPreferences {
+	return &UserPreferences{Timezone: "UTC", Locale: "en", WeekStart: "monday"}
+}
+
+// Location returns the user's time zone, falling back to UTC.
+func (p *UserPreferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Profile is what GET /me returns.
+type Profile struct {
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	CreatedAt     time.Time `json:"created_at"`
+	UserPreferences
 }
 
 type Task struct {
 	ID          int        `json:"id"`
 	UserID      int        `json:"user_id"`
 	CategoryID  *int       `json:"category_id"`
+	ParentID    *int       `json:"parent_id"`
 	Title       string     `json:"title"`
 	Description *string    `json:"description"`
 	Completed   bool       `json:"completed"`
+	Priority    Priority   `json:"priority"`
 	CreatedAt   time.Time  `json:"created_at"`
 	DueDate     *time.Time `json:"due_date"`
+	Version     int        `json:"version"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Category is only filled when the client asks for it with
+	// ?include=category.
+	Category *Category `json:"category,omitempty"`
+	// Tags names the task's tags in alphabetical order.
+	Tags []string `json:"tags,omitempty"`
+	// Progress is filled in listings and single tasks that have subtasks.
+	Progress *TaskProgress `json:"progress,omitempty"`
+}
+
+// Priority ranks how much a task matters. It is stored as a number so it
+// sorts from none to urgent, and written by name in JSON.
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+var priorityNames = []string{"none", "low", "medium", "high", "urgent"}
+
+// PriorityNames lists the priorities from lowest to highest.
+func PriorityNames() []string {
+	return slices.Clone(priorityNames)
+}
+
+func ParsePriority(name string) (Priority, bool) {
+	i := slices.Index(priorityNames, name)
+	return Priority(i), i >= 0
+}
+
+func (p Priority) Valid() bool {
+	return p >= PriorityNone && p <= PriorityUrgent
+}
+
+func (p Priority) String() string {
+	if !p.Valid() {
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+	return priorityNames[p]
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	if !p.Valid() {
+		return nil, fmt.Errorf("invalid priority %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, ok := ParsePriority(string(text))
+	if !ok {
+		return fmt.Errorf("invalid priority %q", text)
+	}
+	*p = parsed
+	return nil
+}
+
+// TaskProgress counts the subtasks at any depth below a task.
+type TaskProgress struct {
+	Subtasks  int `json:"subtasks"`
+	Completed int `json:"completed"`
+	Percent   int `json:"percent"`
+}
+
+func NewTaskProgress(subtasks, completed int) *TaskProgress {
+	p := &TaskProgress{Subtasks: subtasks, Completed: completed}
+	if subtasks > 0 {
+		p.Percent = completed * 100 / subtasks
+	}
+	return p
+}
+
+// TaskNode is a task with its subtasks, as returned for a task tree.
+type TaskNode struct {
+	*Task
+	Subtasks []*TaskNode `json:"subtasks"`
 }
 
 type Category struct {
@@ -26,3 +172,125 @@ type Category struct {
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Tag is a label the user can put on any number of tasks.
+type Tag struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TaskSearchResult struct {
+	Task    *Task   `json:"task"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type CategorySearchResult struct {
+	Category *Category `json:"category"`
+	Rank     float64   `json:"rank"`
+	Snippet  string    `json:"snippet"`
+}
+
+// RefreshToken is a single-use token. Every token obtained by rotating
+// another one shares its FamilyID, which starts at login.
+type RefreshToken struct {
+	ID         int
+	UserID     int
+	FamilyID   string
+	TokenHash  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *int
+}
+
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// EmailVerificationToken confirms that the user owns Email. It is bound to
+// the address so changing the email again invalidates it.
+type EmailVerificationToken struct {
+	ID        int
+	UserID    int
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// TOTP is a user's authenticator app enrollment. It only counts as a second
+// factor once EnabledAt is set. LastStep is the most recent time step a code
+// was accepted for, so codes cannot be replayed.
+type TOTP struct {
+	UserID    int
+	Secret    string
+	CreatedAt time.Time
+	EnabledAt *time.Time
+	LastStep  *int64
+}
+
+// Session is one logged in device. Its ID is the family ID of the refresh
+// tokens issued to the device.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's issuer and subject.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIToken is a long-lived personal access token for scripts. The token
+// itself is only shown once; Prefix identifies it in listings.
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type AuditEntry struct {
+	ID           int64          `json:"id"`
+	ActorID      *int           `json:"actor_id"`
+	Action       string         `json:"action"`
+	TargetUserID *int           `json:"target_user_id"`
+	IP           string         `json:"ip,omitempty"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type TaskStats struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Open      int `json:"open"`
+	Overdue   int `json:"overdue"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Optional distinguishes a field that is absent from a JSON document from one
+// that is present, possibly as an explicit null (Set is true, Value is nil).
+type Optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o.Value = &v
+	return nil
+}
+
+// TaskPatch lists the task fields changed by a partial update. Fields that are
+// not Set keep their current value.
+type TaskPatch struct {
+	Title       Optional[string]
+	Description Optional[string]
+	CategoryID  Optional[int]
+	ParentID    Optional[int]
+	DueDate     Optional[time.Time]
+	Completed   Optional[bool]
+	Priority    Optional[Priority]
+	// Tags holds the tag names; the task repository writes the tags the
+	// service resolved them to.
+	Tags Optional[[]string]
+}
+
+func (p TaskPatch) Empty() bool {
+	return !p.Title.Set && !p.Description.Set && !p.CategoryID.Set && !p.ParentID.Set && !p.DueDate.Set && !p.Completed.Set && !p.Priority.Set && !p.Tags.Set
+}
+
+// PreferencesPatch lists the profile settings changed by PATCH /me.
+type PreferencesPatch struct {
+	DisplayName       Optional[string]
+	Timezone          Optional[string]
+	Locale            Optional[string]
+	WeekStart         Optional[string]
+	DefaultCategoryID Optional[int]
+}
+
+// Apply copies the set fields onto prefs. Required settings that are
+// cleared with null fall back to their defaults.
+func (p PreferencesPatch) Apply(prefs *UserPreferences) {
+	defaults := DefaultPreferences()
+	if p.DisplayName.Set {
+		prefs.DisplayName = p.DisplayName.Value
+	}
+	if p.Timezone.Set {
+		prefs.Timezone = valueOr(p.Timezone.Value, defaults.Timezone)
+	}
+	if p.Locale.Set {
+		prefs.Locale = valueOr(p.Locale.Value, defaults.Locale)
+	}
+	if p.WeekStart.Set {
+		prefs.WeekStart = valueOr(p.WeekStart.Value, defaults.WeekStart)
+	}
+	if p.DefaultCategoryID.Set {
+		prefs.DefaultCategoryID = p.DefaultCategoryID.Value
+	}
+}
+
+func valueOr[T any](v *T, fallback T) T {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
@@ -0,0 +1,51 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+func New(r *http.Request, status int, detail string) *Problem {
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+	}
+}
+
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Write responds with a problem for the status, described by detail.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	New(r, status, detail).Write(w)
+}
+
+// WriteValidation responds with 400 and the problem of every invalid field.
+func WriteValidation(w http.ResponseWriter, r *http.Request, detail string, fields map[string]string) {
+	p := New(r, http.StatusBadRequest, detail)
+	p.Errors = fields
+	p.Write(w)
+}
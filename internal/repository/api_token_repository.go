@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type APITokenRepository struct {
+	DB *sql.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) *APITokenRepository {
+	return &APITokenRepository{DB: db}
+}
+
+const apiTokenColumns = `id, user_id, name, prefix, token_hash, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	var t models.APIToken
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, pq.Array(&t.Scopes), &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt, &t.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	query := `INSERT INTO api_tokens (user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, token.UserID, token.Name, token.Prefix, token.TokenHash, pq.Array(token.Scopes), token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+// ListByUser returns the tokens of the user that have not been revoked.
+func (r *APITokenRepository) ListByUser(ctx context.Context, userID int) ([]*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *APITokenRepository) Revoke(ctx context.Context, tokenID int, userID int) error {
+	query := `UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.DB.ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every token of the user that is not revoked yet.
+func (r *APITokenRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := `UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Use looks up a usable token by hash and records that it was used. Tokens
+// of disabled accounts and of accounts awaiting deletion are not usable.
+func (r *APITokenRepository) Use(ctx context.Context, hash string) (*models.APIToken, error) {
+	query := `UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+			AND user_id IN (SELECT id FROM users WHERE disabled_at IS NULL AND deletion_requested_at IS NULL)
+		RETURNING ` + apiTokenColumns
+	return scanAPIToken(r.DB.QueryRowContext(ctx, query, hash))
+}
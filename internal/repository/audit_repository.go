@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type AuditRepository struct {
+	DB *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry *models.AuditEntry) error {
+	metadata := entry.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO audit_log (actor_id, action, target_user_id, ip, metadata)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, entry.ActorID, entry.Action, entry.TargetUserID, entry.IP, data).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// List returns the newest entries, optionally only those of one action.
+func (r *AuditRepository) List(ctx context.Context, action string, limit int) ([]*models.AuditEntry, error) {
+	query := `SELECT id, actor_id, action, target_user_id, COALESCE(ip, ''), metadata, created_at FROM audit_log`
+	args := []any{}
+	if action != "" {
+		args = append(args, action)
+		query += fmt.Sprintf(" WHERE action = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var metadata []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetUserID, &e.IP, &metadata, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type CategoryRepository interface {
+	Create(ctx context.Context, category *models.Category) error
+	Delete(ctx context.Context, categoryID int, userID int) error
+	ListByUser(ctx context.Context, userID int) ([]*models.Category, error)
+	GetByID(ctx context.Context, categoryID int, userID int) (*models.Category, error)
+	Search(ctx context.Context, userID int, query string, limit int) ([]*models.CategorySearchResult, error)
+}
+
+type PostgresCategoryRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresCategoryRepository(db *sql.DB) *PostgresCategoryRepository {
+	return &PostgresCategoryRepository{DB: db}
+}
+
+func (r *PostgresCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	query := `INSERT INTO categories (user_id, name) VALUES ($1, $2) RETURNING id, created_at`
+	err := r.DB.QueryRowContext(ctx, query, category.UserID, category.Name).Scan(&category.ID, &category.CreatedAt)
+	return err
+}
+
+func (r *PostgresCategoryRepository) Delete(ctx context.Context, categoryID int, userID int) error {
+	query := `DELETE FROM categories WHERE id = $1 AND user_id = $2`
+	res, err := r.DB.ExecContext(ctx, query, categoryID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresCategoryRepository) ListByUser(ctx context.Context, userID int) ([]*models.Category, error) {
+	query := `SELECT id, user_id, name, created_at FROM categories WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []*models.Category
+	for rows.Next() {
+		var c models.Category
+		err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, &c)
+	}
+	return categories, rows.Err()
+}
+
+func (r *PostgresCategoryRepository) GetByID(ctx context.Context, categoryID int, userID int) (*models.Category, error) {
+	query := `SELECT id, user_id, name, created_at FROM categories WHERE id = $1 AND user_id = $2`
+	row := r.DB.QueryRowContext(ctx, query, categoryID, userID)
+	var category models.Category
+	err := row.Scan(&category.ID, &category.UserID, &category.Name, &category.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *PostgresCategoryRepository) Search(ctx context.Context, userID int, query string, limit int) ([]*models.CategorySearchResult, error) {
+	tsquery := prefixTSQuery(query)
+	if tsquery == "" {
+		return nil, nil
+	}
+
+	sqlQuery := `SELECT id, user_id, name, created_at,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('simple', name, q, $3) AS snippet
+		FROM categories, to_tsquery('simple', $2) q
+		WHERE user_id = $1 AND search_vector @@ q
+		ORDER BY rank DESC, id DESC
+		LIMIT $4`
+	rows, err := r.DB.QueryContext(ctx, sqlQuery, userID, tsquery, headlineOptions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.CategorySearchResult
+	for rows.Next() {
+		var c models.Category
+		res := &models.CategorySearchResult{Category: &c}
+		err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &res.Rank, &res.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type EmailVerificationRepository struct {
+	DB *sql.DB
+}
+
+func NewEmailVerificationRepository(db *sql.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{DB: db}
+}
+
+func (r *EmailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	query := `INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, token.UserID, token.Email, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+// Consume marks an unused, unexpired token as used and returns it, or
+// ErrNotFound. The other outstanding tokens of the user are invalidated.
+func (r *EmailVerificationRepository) Consume(ctx context.Context, hash string) (*models.EmailVerificationToken, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE email_verification_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, user_id, email, token_hash, created_at, expires_at, used_at`
+	var t models.EmailVerificationToken
+	err = tx.QueryRowContext(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.Email, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	query = `UPDATE email_verification_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, query, t.UserID); err != nil {
+		return nil, err
+	}
+	return &t, tx.Commit()
+}
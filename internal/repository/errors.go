@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrVersionMismatch = errors.New("record version mismatch")
+	ErrDuplicate       = errors.New("record already exists")
+	// ErrParentCycle is returned when a task would become its own ancestor.
+	ErrParentCycle = errors.New("task cannot be a subtask of itself")
+)
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
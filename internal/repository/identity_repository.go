@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type IdentityRepository struct {
+	DB *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{DB: db}
+}
+
+func (r *IdentityRepository) Get(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	var i models.UserIdentity
+	query := `SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE issuer = $1 AND subject = $2`
+	err := r.DB.QueryRowContext(ctx, query, issuer, subject).Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// CreateWithUser inserts a new user together with its first identity, so a
+// failed link leaves no account behind. It returns ErrDuplicate when the
+// username, the email or the external account is taken.
+func (r *IdentityRepository) CreateWithUser(ctx context.Context, user *models.User, i *models.UserIdentity) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO users (username, email, password_hash, email_verified_at) VALUES ($1, NULLIF($2, ''), $3, $4) RETURNING id, created_at, role`
+	err = tx.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash, user.EmailVerifiedAt).Scan(&user.ID, &user.CreatedAt, &user.Role)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+
+	i.UserID = user.ID
+	query = `INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, i.UserID, i.Issuer, i.Subject, i.Email).Scan(&i.ID, &i.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Create returns ErrDuplicate when the external account is already linked.
+func (r *IdentityRepository) Create(ctx context.Context, i *models.UserIdentity) error {
+	query := `INSERT INTO user_identities (user_id, issuer, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := r.DB.QueryRowContext(ctx, query, i.UserID, i.Issuer, i.Subject, i.Email).Scan(&i.ID, &i.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type MemoryCategoryRepository struct {
+	mu         sync.RWMutex
+	nextID     int
+	categories map[int]*models.Category
+}
+
+func NewMemoryCategoryRepository() *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{
+		nextID:     1,
+		categories: make(map[int]*models.Category),
+	}
+}
+
+func (r *MemoryCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	category.ID = r.nextID
+	category.CreatedAt = time.Now()
+	r.nextID++
+	c := *category
+	r.categories[c.ID] = &c
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Delete(ctx context.Context, categoryID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.categories[categoryID]
+	if !ok || c.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.categories, categoryID)
+	return nil
+}
+
+func (r *MemoryCategoryRepository) ListByUser(ctx context.Context, userID int) ([]*models.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var categories []*models.Category
+	for _, c := range r.categories {
+		if c.UserID != userID {
+			continue
+		}
+		copied := *c
+		categories = append(categories, &copied)
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].CreatedAt.Equal(categories[j].CreatedAt) {
+			return categories[i].ID > categories[j].ID
+		}
+		return categories[i].CreatedAt.After(categories[j].CreatedAt)
+	})
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) GetByID(ctx context.Context, categoryID int, userID int) (*models.Category, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.categories[categoryID]
+	if !ok || c.UserID != userID {
+		return nil, ErrNotFound
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (r *MemoryCategoryRepository) Search(ctx context.Context, userID int, query string, limit int) ([]*models.CategorySearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var results []*models.CategorySearchResult
+	for _, c := range r.categories {
+		if c.UserID != userID || matchTerms(c.Name, terms) < len(terms) {
+			continue
+		}
+		copied := *c
+		results = append(results, &models.CategorySearchResult{
+			Category: &copied,
+			Rank:     float64(len(terms)),
+			Snippet:  highlight(c.Name, terms),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Category.ID > results[j].Category.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+// MemoryTagRepository keeps the tags of the tasks in Tasks, which must be
+// the task repository used alongside it.
+type MemoryTagRepository struct {
+	mu     sync.RWMutex
+	nextID int
+	tags   map[int]*models.Tag
+	Tasks  *MemoryTaskRepository
+}
+
+func NewMemoryTagRepository(tasks *MemoryTaskRepository) *MemoryTagRepository {
+	r := &MemoryTagRepository{
+		nextID: 1,
+		tags:   make(map[int]*models.Tag),
+		Tasks:  tasks,
+	}
+	tasks.tagRepo = r
+	return r
+}
+
+func (r *MemoryTagRepository) Create(ctx context.Context, tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nameTaken(tag) {
+		return ErrDuplicate
+	}
+	tag.ID = r.nextID
+	tag.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.nextID++
+	t := *tag
+	r.tags[t.ID] = &t
+	return nil
+}
+
+func (r *MemoryTagRepository) ListByUser(ctx context.Context, userID int) ([]*models.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(func(t *models.Tag) bool { return t.UserID == userID }), nil
+}
+
+func (r *MemoryTagRepository) GetByID(ctx context.Context, tagID int, userID int) (*models.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tags[tagID]
+	if !ok || t.UserID != userID {
+		return nil, ErrNotFound
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (r *MemoryTagRepository) GetByNames(ctx context.Context, userID int, names []string) ([]*models.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(func(t *models.Tag) bool {
+		return t.UserID == userID && slices.ContainsFunc(names, func(name string) bool {
+			return strings.EqualFold(name, t.Name)
+		})
+	}), nil
+}
+
+func (r *MemoryTagRepository) Update(ctx context.Context, tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tags[tag.ID]
+	if !ok || t.UserID != tag.UserID {
+		return ErrNotFound
+	}
+	if r.nameTaken(tag) {
+		return ErrDuplicate
+	}
+	tag.CreatedAt = t.CreatedAt
+	updated := *tag
+	r.tags[tag.ID] = &updated
+	r.Tasks.replaceTag(tag.ID, tag.ID)
+	return nil
+}
+
+func (r *MemoryTagRepository) Delete(ctx context.Context, tagID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tags[tagID]
+	if !ok || t.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.tags, tagID)
+	r.Tasks.replaceTag(tagID, 0)
+	return nil
+}
+
+func (r *MemoryTagRepository) Merge(ctx context.Context, sourceID int, targetID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source, ok := r.tags[sourceID]
+	if !ok || source.UserID != userID {
+		return ErrNotFound
+	}
+	target, ok := r.tags[targetID]
+	if !ok || target.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.tags, sourceID)
+	r.Tasks.replaceTag(sourceID, targetID)
+	return nil
+}
+
+// withTags runs write with the IDs of the tags for the user, giving tags
+// without an ID the one of the user's tag with that name or a new one. New
+// tags are only stored when write succeeds. Tag IDs of other users are left
+// out. write runs under the tag lock, which is always taken before the
+// lock of the task repository.
+func (r *MemoryTagRepository) withTags(userID int, tags []*models.Tag, write func(tagIDs []int) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nextID := r.nextID
+	var created []*models.Tag
+	tagIDs := []int{}
+	for _, tag := range tags {
+		if tag.ID == 0 {
+			tag.UserID = userID
+			if existing := r.filter(func(t *models.Tag) bool {
+				return t.UserID == tag.UserID && strings.EqualFold(t.Name, tag.Name)
+			}); len(existing) > 0 {
+				*tag = *existing[0]
+			} else {
+				tag.ID = nextID
+				tag.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+				nextID++
+				created = append(created, tag)
+			}
+		} else if t, ok := r.tags[tag.ID]; !ok || t.UserID != userID {
+			continue
+		}
+		if !slices.Contains(tagIDs, tag.ID) {
+			tagIDs = append(tagIDs, tag.ID)
+		}
+	}
+	if err := write(tagIDs); err != nil {
+		return err
+	}
+	for _, tag := range created {
+		t := *tag
+		r.tags[t.ID] = &t
+	}
+	r.nextID = nextID
+	return nil
+}
+
+func (r *MemoryTagRepository) TaskTags(ctx context.Context, userID int, taskIDs []int) (map[int][]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[int][]string)
+	for _, taskID := range taskIDs {
+		var tags []*models.Tag
+		for _, id := range r.Tasks.tagsOf(taskID) {
+			if t, ok := r.tags[id]; ok && t.UserID == userID {
+				tags = append(tags, t)
+			}
+		}
+		if len(tags) > 0 {
+			result[taskID] = tagNames(tags)
+		}
+	}
+	return result, nil
+}
+
+// nameTaken reports whether another tag of the user has the tag's name.
+// Callers must hold the lock.
+func (r *MemoryTagRepository) nameTaken(tag *models.Tag) bool {
+	for _, t := range r.tags {
+		if t.ID != tag.ID && t.UserID == tag.UserID && strings.EqualFold(t.Name, tag.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns copies of the matching tags sorted by name. Callers must
+// hold the lock.
+func (r *MemoryTagRepository) filter(match func(*models.Tag) bool) []*models.Tag {
+	var tags []*models.Tag
+	for _, t := range r.tags {
+		if match(t) {
+			copied := *t
+			tags = append(tags, &copied)
+		}
+	}
+	slices.SortFunc(tags, compareTagNames)
+	return tags
+}
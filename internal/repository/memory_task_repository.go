@@ -0,0 +1,568 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type MemoryTaskRepository struct {
+	mu     sync.RWMutex
+	nextID int
+	tasks  map[int]*models.Task
+	// tags holds the tag IDs of each task. MemoryTagRepository maintains
+	// it along with the task writes that set tags, which it sets up through
+	// tagRepo.
+	tags    map[int][]int
+	tagRepo *MemoryTagRepository
+}
+
+func NewMemoryTaskRepository() *MemoryTaskRepository {
+	return &MemoryTaskRepository{
+		nextID: 1,
+		tasks:  make(map[int]*models.Task),
+		tags:   make(map[int][]int),
+	}
+}
+
+func (r *MemoryTaskRepository) Create(ctx context.Context, task *models.Task, tags []*models.Tag) error {
+	err := r.withTags(task.UserID, tags, len(tags) > 0, func(tagIDs []int) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		task.ID = r.nextID
+		task.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		task.UpdatedAt = task.CreatedAt
+		task.Version = 1
+		r.nextID++
+		r.tasks[task.ID] = cloneTask(task)
+		if tagIDs != nil {
+			r.tags[task.ID] = tagIDs
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	task.Tags = tagNames(tags)
+	return nil
+}
+
+// withTags runs write with the IDs of the tags when replace is set, and
+// with nil tag IDs otherwise.
+func (r *MemoryTaskRepository) withTags(userID int, tags []*models.Tag, replace bool, write func(tagIDs []int) error) error {
+	if !replace {
+		return write(nil)
+	}
+	if r.tagRepo == nil {
+		return errors.New("memory task repository has no tag repository")
+	}
+	return r.tagRepo.withTags(userID, tags, write)
+}
+
+func (r *MemoryTaskRepository) List(ctx context.Context, filter TaskFilter) ([]*models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var cursor *models.Task
+	if filter.Cursor != nil {
+		cursor = filter.Cursor.task()
+	}
+
+	now := time.Now()
+	query := strings.ToLower(filter.Query)
+	var tasks []*models.Task
+	for _, t := range r.tasks {
+		if t.UserID != filter.UserID {
+			continue
+		}
+		if filter.CategoryID != nil && (t.CategoryID == nil || *t.CategoryID != *filter.CategoryID) {
+			continue
+		}
+		if filter.ParentID != nil && (t.ParentID == nil || *t.ParentID != *filter.ParentID) {
+			continue
+		}
+		if filter.TopLevel && t.ParentID != nil {
+			continue
+		}
+		if len(filter.TagIDs) > 0 && !r.hasTags(t.ID, filter.TagIDs, filter.AllTags) {
+			continue
+		}
+		if filter.Completed != nil && t.Completed != *filter.Completed {
+			continue
+		}
+		if filter.DueBefore != nil && (t.DueDate == nil || !t.DueDate.Before(*filter.DueBefore)) {
+			continue
+		}
+		if filter.DueAfter != nil && (t.DueDate == nil || !t.DueDate.After(*filter.DueAfter)) {
+			continue
+		}
+		if filter.Overdue && (t.Completed || t.DueDate == nil || !t.DueDate.Before(now)) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(t.Title), query) {
+			continue
+		}
+		if cursor != nil && compareTasks(cursor, t, filter.Sort, filter.Descending) >= 0 {
+			continue
+		}
+		tasks = append(tasks, cloneTask(t))
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return compareTasks(tasks[i], tasks[j], filter.Sort, filter.Descending) < 0
+	})
+	if filter.Limit > 0 && len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks, nil
+}
+
+// compareTasks orders tasks the same way PostgresTaskRepository.List does:
+// by the sort field, then by id, with tasks without a due date last.
+func compareTasks(a, b *models.Task, sort TaskSort, desc bool) int {
+	var c int
+	switch sort {
+	case SortDueDate:
+		switch {
+		case a.DueDate == nil && b.DueDate == nil:
+		case a.DueDate == nil:
+			return 1
+		case b.DueDate == nil:
+			return -1
+		default:
+			c = a.DueDate.Compare(*b.DueDate)
+		}
+	case SortTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case SortPriority:
+		c = cmp.Compare(a.Priority, b.Priority)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if desc {
+		return -c
+	}
+	return c
+}
+
+func (r *MemoryTaskRepository) GetByID(ctx context.Context, taskID int, userID int) (*models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.tasks[taskID]
+	if !ok || t.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return cloneTask(t), nil
+}
+
+func (r *MemoryTaskRepository) Update(ctx context.Context, task *models.Task, tags []*models.Tag, ifVersion *int) error {
+	replace := task.Tags != nil
+	err := r.withTags(task.UserID, tags, replace, func(tagIDs []int) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		t, err := r.lookup(task.ID, task.UserID, ifVersion)
+		if err != nil {
+			return err
+		}
+		if r.wouldCycle(task.ID, task.ParentID) {
+			return ErrParentCycle
+		}
+		task.CreatedAt = t.CreatedAt
+		task.Version = t.Version + 1
+		task.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		r.tasks[task.ID] = cloneTask(task)
+		if tagIDs != nil {
+			r.tags[task.ID] = tagIDs
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if replace {
+		task.Tags = tagNames(tags)
+	}
+	return nil
+}
+
+func (r *MemoryTaskRepository) Delete(ctx context.Context, taskID int, userID int, ifVersion *int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.lookup(taskID, userID, ifVersion); err != nil {
+		return err
+	}
+	// Subtasks go with their parent, like ON DELETE CASCADE.
+	for _, t := range r.descendants(taskID) {
+		delete(r.tasks, t.ID)
+		delete(r.tags, t.ID)
+	}
+	delete(r.tasks, taskID)
+	delete(r.tags, taskID)
+	return nil
+}
+
+func (r *MemoryTaskRepository) Patch(ctx context.Context, taskID int, userID int, patch models.TaskPatch, tags []*models.Tag, ifVersion *int) (*models.Task, error) {
+	var updated *models.Task
+	err := r.withTags(userID, tags, patch.Tags.Set, func(tagIDs []int) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		t, err := r.lookup(taskID, userID, ifVersion)
+		if err != nil {
+			return err
+		}
+		updated = cloneTask(t)
+		if patch.Empty() {
+			return nil
+		}
+
+		if patch.Title.Set && patch.Title.Value != nil {
+			updated.Title = *patch.Title.Value
+		}
+		if patch.Description.Set {
+			updated.Description = patch.Description.Value
+		}
+		if patch.CategoryID.Set {
+			updated.CategoryID = patch.CategoryID.Value
+		}
+		if patch.ParentID.Set {
+			if r.wouldCycle(taskID, patch.ParentID.Value) {
+				return ErrParentCycle
+			}
+			updated.ParentID = patch.ParentID.Value
+		}
+		if patch.DueDate.Set {
+			updated.DueDate = patch.DueDate.Value
+		}
+		if patch.Completed.Set && patch.Completed.Value != nil {
+			updated.Completed = *patch.Completed.Value
+		}
+		if patch.Priority.Set && patch.Priority.Value != nil {
+			updated.Priority = *patch.Priority.Value
+		}
+		updated.Version++
+		updated.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+		r.tasks[taskID] = cloneTask(updated)
+		if tagIDs != nil {
+			r.tags[taskID] = tagIDs
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if patch.Tags.Set {
+		updated.Tags = tagNames(tags)
+	}
+	return updated, nil
+}
+
+// wouldCycle reports whether parentID is the task or one of its subtasks.
+// Callers must hold the lock.
+func (r *MemoryTaskRepository) wouldCycle(taskID int, parentID *int) bool {
+	if parentID == nil {
+		return false
+	}
+	return *parentID == taskID || slices.ContainsFunc(r.descendants(taskID), func(t *models.Task) bool {
+		return t.ID == *parentID
+	})
+}
+
+// lookup returns the stored task owned by the user, checking its version when
+// one is expected. Callers must hold the lock.
+func (r *MemoryTaskRepository) lookup(taskID int, userID int, ifVersion *int) (*models.Task, error) {
+	t, ok := r.tasks[taskID]
+	if !ok || t.UserID != userID {
+		return nil, ErrNotFound
+	}
+	if ifVersion != nil && t.Version != *ifVersion {
+		return nil, ErrVersionMismatch
+	}
+	return t, nil
+}
+
+func (r *MemoryTaskRepository) Search(ctx context.Context, userID int, query string, limit int) ([]*models.TaskSearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var results []*models.TaskSearchResult
+	for _, t := range r.tasks {
+		if t.UserID != userID {
+			continue
+		}
+		text := t.Title
+		if t.Description != nil {
+			text += " " + *t.Description
+		}
+		if matchTerms(text, terms) < len(terms) {
+			continue
+		}
+		// Title hits weigh more than description hits, like the A and B
+		// weights of the Postgres search vector.
+		rank := float64(matchTerms(t.Title, terms))
+		if t.Description != nil {
+			rank += 0.4 * float64(matchTerms(*t.Description, terms))
+		}
+		results = append(results, &models.TaskSearchResult{
+			Task:    cloneTask(t),
+			Rank:    rank,
+			Snippet: highlight(text, terms),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank == results[j].Rank {
+			return results[i].Task.ID > results[j].Task.ID
+		}
+		return results[i].Rank > results[j].Rank
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (r *MemoryTaskRepository) Subtree(ctx context.Context, taskID int, userID int) ([]*models.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, err := r.lookup(taskID, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []*models.Task{cloneTask(t)}
+	for _, d := range r.descendants(taskID) {
+		tasks = append(tasks, cloneTask(d))
+	}
+	return tasks, nil
+}
+
+func (r *MemoryTaskRepository) Progress(ctx context.Context, userID int, taskIDs []int) (map[int]*models.TaskProgress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	progress := make(map[int]*models.TaskProgress)
+	for _, id := range taskIDs {
+		if t, ok := r.tasks[id]; !ok || t.UserID != userID {
+			continue
+		}
+		descendants := r.descendants(id)
+		if len(descendants) == 0 {
+			continue
+		}
+		completed := 0
+		for _, d := range descendants {
+			if d.Completed {
+				completed++
+			}
+		}
+		progress[id] = models.NewTaskProgress(len(descendants), completed)
+	}
+	return progress, nil
+}
+
+func (r *MemoryTaskRepository) CompleteSubtasks(ctx context.Context, taskID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if t, ok := r.tasks[taskID]; !ok || t.UserID != userID {
+		return nil
+	}
+	for _, d := range r.descendants(taskID) {
+		if !d.Completed {
+			r.setCompleted(d, true)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryTaskRepository) ReopenAncestors(ctx context.Context, taskID int, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tasks[taskID]
+	if !ok || t.UserID != userID {
+		return nil
+	}
+	seen := map[int]bool{taskID: true}
+	for t.ParentID != nil && !seen[*t.ParentID] {
+		seen[*t.ParentID] = true
+		if t, ok = r.tasks[*t.ParentID]; !ok || t.UserID != userID {
+			break
+		}
+		if t.Completed {
+			r.setCompleted(t, false)
+		}
+	}
+	return nil
+}
+
+// descendants returns the subtasks at any depth below the task, shallowest
+// first and in creation order within a level. Only tasks of the same user
+// count, and each task once. Callers must hold the lock.
+func (r *MemoryTaskRepository) descendants(taskID int) []*models.Task {
+	root, ok := r.tasks[taskID]
+	if !ok {
+		return nil
+	}
+	var result []*models.Task
+	seen := map[int]bool{taskID: true}
+	level := []int{taskID}
+	for len(level) > 0 {
+		var children []*models.Task
+		for _, t := range r.tasks {
+			if t.ParentID != nil && slices.Contains(level, *t.ParentID) && t.UserID == root.UserID && !seen[t.ID] {
+				seen[t.ID] = true
+				children = append(children, t)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return compareTasks(children[i], children[j], SortCreatedAt, false) < 0
+		})
+		level = level[:0]
+		for _, c := range children {
+			level = append(level, c.ID)
+		}
+		result = append(result, children...)
+	}
+	return result
+}
+
+// hasTags reports whether the task carries any, or all, of the tags.
+// Callers must hold the lock.
+func (r *MemoryTaskRepository) hasTags(taskID int, tagIDs []int, all bool) bool {
+	matched := 0
+	for _, id := range tagIDs {
+		if slices.Contains(r.tags[taskID], id) {
+			matched++
+		}
+	}
+	if all {
+		return matched == len(tagIDs)
+	}
+	return matched > 0
+}
+
+// tagsOf returns the tag IDs of the task.
+func (r *MemoryTaskRepository) tagsOf(taskID int) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.tags[taskID])
+}
+
+// replaceTag swaps the tag from for the tag to on every task, or removes it
+// when to is zero, and gives those tasks a new version. Replacing a tag by
+// itself only does the latter, for when the tag itself changed.
+func (r *MemoryTaskRepository) replaceTag(from, to int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for taskID, ids := range r.tags {
+		i := slices.Index(ids, from)
+		if i < 0 {
+			continue
+		}
+		ids = slices.Delete(slices.Clone(ids), i, i+1)
+		if to != 0 && !slices.Contains(ids, to) {
+			ids = append(ids, to)
+		}
+		r.tags[taskID] = ids
+
+		updated := cloneTask(r.tasks[taskID])
+		updated.Version++
+		updated.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		r.tasks[taskID] = updated
+	}
+}
+
+// setCompleted changes a stored task in place. Callers must hold the lock.
+func (r *MemoryTaskRepository) setCompleted(t *models.Task, completed bool) {
+	updated := cloneTask(t)
+	updated.Completed = completed
+	updated.Version++
+	updated.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	r.tasks[t.ID] = updated
+}
+
+func (r *MemoryTaskRepository) Matrix(ctx context.Context, userID int, urgentBefore time.Time, limit int) ([4]TaskQuadrant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matrix [4]TaskQuadrant
+	for _, t := range r.tasks {
+		if t.UserID != userID || t.Completed {
+			continue
+		}
+		q := QuadrantOf(t, urgentBefore)
+		matrix[q].Tasks = append(matrix[q].Tasks, cloneTask(t))
+		matrix[q].Total++
+	}
+	for i := range matrix {
+		slices.SortFunc(matrix[i].Tasks, compareMatrixTasks)
+		if len(matrix[i].Tasks) > limit {
+			matrix[i].Tasks = matrix[i].Tasks[:limit]
+		}
+	}
+	return matrix, nil
+}
+
+func (r *MemoryTaskRepository) Stats(ctx context.Context) (*models.TaskStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var stats models.TaskStats
+	for _, t := range r.tasks {
+		stats.Total++
+		if t.Completed {
+			stats.Completed++
+			continue
+		}
+		stats.Open++
+		if t.DueDate != nil && t.DueDate.Before(now) {
+			stats.Overdue++
+		}
+	}
+	return &stats, nil
+}
+
+func cloneTask(t *models.Task) *models.Task {
+	c := *t
+	if t.Description != nil {
+		d := *t.Description
+		c.Description = &d
+	}
+	if t.CategoryID != nil {
+		id := *t.CategoryID
+		c.CategoryID = &id
+	}
+	if t.ParentID != nil {
+		id := *t.ParentID
+		c.ParentID = &id
+	}
+	if t.DueDate != nil {
+		due := *t.DueDate
+		c.DueDate = &due
+	}
+	return &c
+}
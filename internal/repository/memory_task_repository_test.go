@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+// Tasks created in one statement, or imported together, share created_at;
+// paging through them must still visit each task exactly once.
+func TestListPagesThroughEqualCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryTaskRepository()
+	var want []int
+	for range 5 {
+		task := &models.Task{UserID: 1, Title: "Task"}
+		if err := r.Create(ctx, task, nil); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, task.ID)
+	}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, task := range r.tasks {
+		task.CreatedAt = created
+	}
+
+	for _, desc := range []bool{false, true} {
+		filter := TaskFilter{UserID: 1, Sort: SortCreatedAt, Descending: desc, Limit: 2}
+		var got []int
+		for {
+			page, err := r.List(ctx, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range page {
+				got = append(got, task.ID)
+			}
+			if len(page) < filter.Limit {
+				break
+			}
+			// Go through the encoded form, as clients do.
+			cursor, err := DecodeTaskCursor(NewTaskCursor(page[len(page)-1], filter.Sort, filter.Descending).Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter.Cursor = cursor
+		}
+
+		expected := slices.Clone(want)
+		if desc {
+			slices.Reverse(expected)
+		}
+		if !slices.Equal(got, expected) {
+			t.Errorf("descending=%v: paged through %v, want %v", desc, got, expected)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type PasswordResetRepository struct {
+	DB *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{DB: db}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, token.UserID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+// GetValid returns the token with the given hash if it is unused and has not
+// expired, or ErrNotFound.
+func (r *PasswordResetRepository) GetValid(ctx context.Context, hash string) (*models.PasswordResetToken, error) {
+	query := `SELECT id, user_id, token_hash, created_at, expires_at, used_at FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+	var t models.PasswordResetToken
+	err := r.DB.QueryRowContext(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Consume marks an unused, unexpired token as used and returns the user it
+// was issued to. Every other outstanding token of that user is invalidated
+// as well. It returns ErrNotFound when no such token exists.
+func (r *PasswordResetRepository) Consume(ctx context.Context, hash string) (int, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	query := `UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`
+	if err := tx.QueryRowContext(ctx, query, hash).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	query = `UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type PreferencesRepository struct {
+	DB *sql.DB
+}
+
+func NewPreferencesRepository(db *sql.DB) *PreferencesRepository {
+	return &PreferencesRepository{DB: db}
+}
+
+// Get returns the saved preferences, or the defaults when the user never
+// saved any.
+func (r *PreferencesRepository) Get(ctx context.Context, userID int) (*models.UserPreferences, error) {
+	query := `SELECT display_name, timezone, locale, week_start, default_category_id FROM user_preferences WHERE user_id = $1`
+	var p models.UserPreferences
+	err := r.DB.QueryRowContext(ctx, query, userID).Scan(&p.DisplayName, &p.Timezone, &p.Locale, &p.WeekStart, &p.DefaultCategoryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultPreferences(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *PreferencesRepository) Save(ctx context.Context, userID int, p *models.UserPreferences) error {
+	query := `INSERT INTO user_preferences (user_id, display_name, timezone, locale, week_start, default_category_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET display_name = EXCLUDED.display_name, timezone = EXCLUDED.timezone,
+			locale = EXCLUDED.locale, week_start = EXCLUDED.week_start,
+			default_category_id = EXCLUDED.default_category_id, updated_at = CURRENT_TIMESTAMP`
+	_, err := r.DB.ExecContext(ctx, query, userID, p.DisplayName, p.Timezone, p.Locale, p.WeekStart, p.DefaultCategoryID)
+	return err
+}
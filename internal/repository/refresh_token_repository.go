@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+var ErrTokenAlreadyUsed = errors.New("token already used")
+
+type RefreshTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{DB: db}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	return r.DB.QueryRowContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := `SELECT id, user_id, family_id, token_hash, created_at, expires_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = $1`
+	var t models.RefreshToken
+	err := r.DB.QueryRowContext(ctx, query, hash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt, &t.ReplacedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Rotate revokes old and stores next as its replacement in one transaction.
+// It fails with ErrTokenAlreadyUsed when old was revoked concurrently.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, old *models.RefreshToken, next *models.RefreshToken) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`, old.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET replaced_by = $1 WHERE id = $2`, next.ID, old.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeFamily revokes the refresh tokens of a family and ends the session
+// it belongs to.
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := `WITH ended AS (
+			UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// RevokeAllForUser revokes every refresh token and session of the user.
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := `WITH ended AS (
+			UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL
+		)
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// headlineOptions configures ts_headline to produce the same markers as the
+// in-memory highlighter.
+const headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=30, MinWords=10, MaxFragments=2"
+
+// searchTerms splits a user query into lower-cased words, dropping anything
+// that is not a letter or a digit so the result is safe to use in a tsquery.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery builds a tsquery where every term has to match the prefix of
+// some word, e.g. "buy milk" becomes "buy:* & milk:*".
+func prefixTSQuery(query string) string {
+	terms := searchTerms(query)
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// matchTerms reports how many of the terms prefix-match a word of text.
+func matchTerms(text string, terms []string) int {
+	words := searchTerms(text)
+	matched := 0
+	for _, term := range terms {
+		for _, w := range words {
+			if strings.HasPrefix(w, term) {
+				matched++
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// highlight wraps every word of text that starts with one of the terms in
+// highlight markers.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		word := string(runes[i:j])
+		if hasTermPrefix(strings.ToLower(word), terms) {
+			b.WriteString(highlightStart + word + highlightStop)
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func hasTermPrefix(word string, terms []string) bool {
+	for _, t := range terms {
+		if strings.HasPrefix(word, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type SessionRepository struct {
+	DB *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+const sessionColumns = `id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at`
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var s models.Session
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save stores a new session or, when it exists, records that the device was
+// seen again with the given IP, user agent and expiry. Revoked sessions stay
+// revoked.
+func (r *SessionRepository) Save(ctx context.Context, s *models.Session) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET user_agent = EXCLUDED.user_agent, ip = EXCLUDED.ip,
+			expires_at = EXCLUDED.expires_at, last_seen_at = CURRENT_TIMESTAMP
+		RETURNING ` + sessionColumns
+	saved, err := scanSession(r.DB.QueryRowContext(ctx, query, s.ID, s.UserID, s.UserAgent, s.IP, s.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	*s = *saved
+	return nil
+}
+
+// CreatedWithin reports whether the user's session is active and was
+// started, that is logged in, less than d ago.
+func (r *SessionRepository) CreatedWithin(ctx context.Context, id string, userID int, d time.Duration) (bool, error) {
+	var fresh bool
+	query := `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $3))`
+	err := r.DB.QueryRowContext(ctx, query, id, userID, d.Seconds()).Scan(&fresh)
+	return fresh, err
+}
+
+func (r *SessionRepository) Get(ctx context.Context, id string) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	return scanSession(r.DB.QueryRowContext(ctx, query, id))
+}
+
+// ListActive returns the sessions of the user that are neither revoked nor
+// expired, most recently used first.
+func (r *SessionRepository) ListActive(ctx context.Context, userID int) ([]*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC`
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchLastSeen updates last_seen_at unless it was updated within the
+// last minute, to avoid a write on every request.
+func (r *SessionRepository) TouchLastSeen(ctx context.Context, id string) error {
+	query := `UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'`
+	_, err := r.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Revoke ends an active session of the user and revokes its refresh tokens.
+// It returns ErrNotFound when there is no such session.
+func (r *SessionRepository) Revoke(ctx context.Context, userID int, id string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := tx.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
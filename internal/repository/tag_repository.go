@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+// TagRepository stores tags and which tasks carry them. Tag names are unique
+// per user, ignoring case; writes that would break that fail with
+// ErrDuplicate.
+type TagRepository interface {
+	Create(ctx context.Context, tag *models.Tag) error
+	ListByUser(ctx context.Context, userID int) ([]*models.Tag, error)
+	GetByID(ctx context.Context, tagID int, userID int) (*models.Tag, error)
+	// GetByNames returns the user's tags with any of the names.
+	GetByNames(ctx context.Context, userID int, names []string) ([]*models.Tag, error)
+	// Update saves the tag's name and color. Update, Delete and Merge give
+	// every task carrying the tag a new version, so cached copies of the
+	// tasks with the old tags fail their preconditions.
+	Update(ctx context.Context, tag *models.Tag) error
+	Delete(ctx context.Context, tagID int, userID int) error
+	// Merge moves the source tag onto every task that carries it to the
+	// target tag and deletes the source tag.
+	Merge(ctx context.Context, sourceID int, targetID int, userID int) error
+	// TaskTags returns the sorted tag names of each of the given tasks.
+	// Tasks without tags are left out.
+	TaskTags(ctx context.Context, userID int, taskIDs []int) (map[int][]string, error)
+}
+
+const tagColumns = `id, user_id, name, color, created_at`
+
+func scanTag(row rowScanner) (*models.Tag, error) {
+	var t models.Tag
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Color, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+type PostgresTagRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresTagRepository(db *sql.DB) *PostgresTagRepository {
+	return &PostgresTagRepository{DB: db}
+}
+
+func (r *PostgresTagRepository) Create(ctx context.Context, tag *models.Tag) error {
+	query := `INSERT INTO tags (user_id, name, color) VALUES ($1, $2, $3) RETURNING id, created_at`
+	err := r.DB.QueryRowContext(ctx, query, tag.UserID, tag.Name, tag.Color).Scan(&tag.ID, &tag.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *PostgresTagRepository) ListByUser(ctx context.Context, userID int) ([]*models.Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE user_id = $1 ORDER BY LOWER(name), id`
+	return r.query(ctx, query, userID)
+}
+
+func (r *PostgresTagRepository) GetByID(ctx context.Context, tagID int, userID int) (*models.Tag, error) {
+	query := `SELECT ` + tagColumns + ` FROM tags WHERE id = $1 AND user_id = $2`
+	return scanTag(r.DB.QueryRowContext(ctx, query, tagID, userID))
+}
+
+func (r *PostgresTagRepository) GetByNames(ctx context.Context, userID int, names []string) ([]*models.Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	query := `SELECT ` + tagColumns + ` FROM tags
+		WHERE user_id = $1 AND LOWER(name) IN (SELECT LOWER(n) FROM UNNEST($2::text[]) n)
+		ORDER BY LOWER(name), id`
+	return r.query(ctx, query, userID, pq.Array(names))
+}
+
+func (r *PostgresTagRepository) query(ctx context.Context, query string, args ...any) ([]*models.Tag, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// touchTaggedTasks gives the tasks carrying the tags of a CTE named
+// "changed" a new version.
+const touchTaggedTasks = `touched AS (
+		UPDATE tasks SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT task_id FROM task_tags WHERE tag_id IN (SELECT id FROM changed))
+	)`
+
+func (r *PostgresTagRepository) Update(ctx context.Context, tag *models.Tag) error {
+	query := `WITH changed AS (
+			UPDATE tags SET name = $1, color = $2 WHERE id = $3 AND user_id = $4 RETURNING id, created_at
+		), ` + touchTaggedTasks + `
+		SELECT created_at FROM changed`
+	err := r.DB.QueryRowContext(ctx, query, tag.Name, tag.Color, tag.ID, tag.UserID).Scan(&tag.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *PostgresTagRepository) Delete(ctx context.Context, tagID int, userID int) error {
+	// All parts of the statement see the tables as they were before it, so
+	// task_tags still lists the tasks of the deleted tag.
+	query := `WITH changed AS (
+			DELETE FROM tags WHERE id = $1 AND user_id = $2 RETURNING id
+		), ` + touchTaggedTasks + `
+		SELECT COUNT(*) FROM changed`
+	var n int
+	if err := r.DB.QueryRowContext(ctx, query, tagID, userID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresTagRepository) Merge(ctx context.Context, sourceID int, targetID int, userID int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owned int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tags WHERE id IN ($1, $2) AND user_id = $3`, sourceID, targetID, userID).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if owned != 2 {
+		return ErrNotFound
+	}
+
+	query := `UPDATE tasks SET version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT task_id FROM task_tags WHERE tag_id = $1)`
+	if _, err := tx.ExecContext(ctx, query, sourceID); err != nil {
+		return err
+	}
+	query = `INSERT INTO task_tags (task_id, tag_id)
+		SELECT task_id, $2 FROM task_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, sourceID, targetID); err != nil {
+		return err
+	}
+	// Deleting the source tag removes its task_tags rows by cascade.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, sourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceTaskTags replaces the tags of the task inside the transaction that
+// writes the task, which gives it its new version.
+func replaceTaskTags(ctx context.Context, tx *sql.Tx, task *models.Task, tags []*models.Tag) error {
+	if err := createTags(ctx, tx, task.UserID, tags); err != nil {
+		return err
+	}
+	tagIDs := make([]int, len(tags))
+	for i, t := range tags {
+		tagIDs[i] = t.ID
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM task_tags WHERE task_id = $1 AND NOT (tag_id = ANY($2))`, task.ID, pq.Array(tagIDs)); err != nil {
+		return err
+	}
+	query := `INSERT INTO task_tags (task_id, tag_id)
+		SELECT $1, id FROM tags WHERE id = ANY($2) AND user_id = $3
+		ON CONFLICT DO NOTHING`
+	_, err := tx.ExecContext(ctx, query, task.ID, pq.Array(tagIDs), task.UserID)
+	return err
+}
+
+// createTags inserts the tags that have no ID yet. When another request
+// created a tag of the same name in the meantime, that one is used.
+func createTags(ctx context.Context, tx *sql.Tx, userID int, tags []*models.Tag) error {
+	for _, t := range tags {
+		if t.ID != 0 {
+			continue
+		}
+		t.UserID = userID
+		query := `INSERT INTO tags (user_id, name, color) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING id, created_at`
+		err := tx.QueryRowContext(ctx, query, t.UserID, t.Name, t.Color).Scan(&t.ID, &t.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			query = `SELECT ` + tagColumns + ` FROM tags WHERE user_id = $1 AND LOWER(name) = LOWER($2)`
+			existing, err := scanTag(tx.QueryRowContext(ctx, query, t.UserID, t.Name))
+			if err != nil {
+				return err
+			}
+			*t = *existing
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PostgresTagRepository) TaskTags(ctx context.Context, userID int, taskIDs []int) (map[int][]string, error) {
+	result := make(map[int][]string)
+	if len(taskIDs) == 0 {
+		return result, nil
+	}
+	query := `SELECT tt.task_id, t.name FROM task_tags tt JOIN tags t ON t.id = tt.tag_id
+		WHERE t.user_id = $1 AND tt.task_id = ANY($2)
+		ORDER BY tt.task_id, LOWER(t.name), t.id`
+	rows, err := r.DB.QueryContext(ctx, query, userID, pq.Array(taskIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int
+		var name string
+		if err := rows.Scan(&taskID, &name); err != nil {
+			return nil, err
+		}
+		result[taskID] = append(result[taskID], name)
+	}
+	return result, rows.Err()
+}
+
+// tagNames returns the names of the tags in the order TaskTags uses.
+func tagNames(tags []*models.Tag) []string {
+	sorted := slices.Clone(tags)
+	slices.SortFunc(sorted, compareTagNames)
+	names := make([]string, len(sorted))
+	for i, t := range sorted {
+		names[i] = t.Name
+	}
+	return names
+}
+
+func compareTagNames(a, b *models.Tag) int {
+	if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type TaskSort string
+
+const (
+	SortCreatedAt TaskSort = "created_at"
+	SortDueDate   TaskSort = "due_date"
+	SortTitle     TaskSort = "title"
+	SortPriority  TaskSort = "priority"
+)
+
+// cursorTimeLayout omits the zone because task timestamps are stored
+// without one.
+const cursorTimeLayout = "2006-01-02T15:04:05.999999"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (s TaskSort) Valid() bool {
+	switch s {
+	case SortCreatedAt, SortDueDate, SortTitle, SortPriority:
+		return true
+	}
+	return false
+}
+
+type TaskFilter struct {
+	UserID     int
+	CategoryID *int
+	ParentID   *int
+	// TopLevel leaves out subtasks.
+	TopLevel bool
+	// Tags keeps tasks carrying any of the named tags, or all of them when
+	// AllTags is set. The service resolves the names into TagIDs, which is
+	// what the repositories filter on.
+	Tags       []string
+	TagIDs     []int
+	AllTags    bool
+	Completed  *bool
+	DueBefore  *time.Time
+	DueAfter   *time.Time
+	Overdue    bool
+	Query      string
+	Sort       TaskSort
+	Descending bool
+	Limit      int
+	Cursor     *TaskCursor
+}
+
+// TaskCursor marks the last task of a page. It carries the sort it was built
+// for so a cursor cannot be replayed against a different ordering.
+type TaskCursor struct {
+	Sort       TaskSort `json:"s"`
+	Descending bool     `json:"d"`
+	Value      string   `json:"v"`
+	ID         int      `json:"id"`
+}
+
+func NewTaskCursor(task *models.Task, sort TaskSort, desc bool) *TaskCursor {
+	c := &TaskCursor{Sort: sort, Descending: desc, ID: task.ID}
+	switch sort {
+	case SortDueDate:
+		if task.DueDate != nil {
+			c.Value = task.DueDate.UTC().Format(cursorTimeLayout)
+		} else if desc {
+			c.Value = "-infinity"
+		} else {
+			c.Value = "infinity"
+		}
+	case SortTitle:
+		c.Value = task.Title
+	case SortPriority:
+		c.Value = strconv.Itoa(int(task.Priority))
+	default:
+		c.Value = task.CreatedAt.UTC().Format(cursorTimeLayout)
+	}
+	return c
+}
+
+func (c *TaskCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeTaskCursor(s string) (*TaskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c TaskCursor
+	if err := json.Unmarshal(data, &c); err != nil || !c.Sort.Valid() {
+		return nil, ErrInvalidCursor
+	}
+	switch c.Sort {
+	case SortTitle:
+	case SortPriority:
+		if p, err := strconv.Atoi(c.Value); err != nil || !models.Priority(p).Valid() {
+			return nil, ErrInvalidCursor
+		}
+	default:
+		if !isInfinity(c.Value) {
+			if _, err := time.Parse(cursorTimeLayout, c.Value); err != nil {
+				return nil, ErrInvalidCursor
+			}
+		}
+	}
+	return &c, nil
+}
+
+// task rebuilds the sort key of the cursor as a task so in-memory
+// implementations can compare it with the regular ordering.
+func (c *TaskCursor) task() *models.Task {
+	t := &models.Task{ID: c.ID}
+	switch c.Sort {
+	case SortTitle:
+		t.Title = c.Value
+	case SortPriority:
+		p, _ := strconv.Atoi(c.Value)
+		t.Priority = models.Priority(p)
+	case SortDueDate:
+		if !isInfinity(c.Value) {
+			due, _ := time.Parse(cursorTimeLayout, c.Value)
+			t.DueDate = &due
+		}
+	default:
+		t.CreatedAt, _ = time.Parse(cursorTimeLayout, c.Value)
+	}
+	return t
+}
+
+func isInfinity(v string) bool {
+	return v == "infinity" || v == "-infinity"
+}
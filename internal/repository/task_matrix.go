@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+// Quadrant numbers the quadrants of an Eisenhower matrix.
+type Quadrant int
+
+const (
+	// QuadrantDo holds the important, urgent tasks.
+	QuadrantDo Quadrant = iota
+	// QuadrantSchedule holds the important tasks that are not urgent.
+	QuadrantSchedule
+	// QuadrantDelegate holds the urgent tasks that are not important.
+	QuadrantDelegate
+	// QuadrantEliminate holds the tasks that are neither.
+	QuadrantEliminate
+)
+
+// TaskQuadrant is the first tasks of a quadrant and how many it holds.
+type TaskQuadrant struct {
+	Tasks []*models.Task
+	Total int
+}
+
+// QuadrantOf places a task in the matrix. A task is important when its
+// priority is high or urgent, and urgent when its priority is urgent or it
+// is due before urgentBefore, which includes overdue tasks.
+func QuadrantOf(t *models.Task, urgentBefore time.Time) Quadrant {
+	important := t.Priority >= models.PriorityHigh
+	urgent := t.Priority == models.PriorityUrgent || (t.DueDate != nil && t.DueDate.Before(urgentBefore))
+	switch {
+	case important && urgent:
+		return QuadrantDo
+	case important:
+		return QuadrantSchedule
+	case urgent:
+		return QuadrantDelegate
+	default:
+		return QuadrantEliminate
+	}
+}
+
+// compareMatrixTasks orders the tasks of a quadrant due soonest first, then
+// by priority, with tasks without a due date last.
+func compareMatrixTasks(a, b *models.Task) int {
+	switch {
+	case a.DueDate == nil && b.DueDate == nil:
+	case a.DueDate == nil:
+		return 1
+	case b.DueDate == nil:
+		return -1
+	default:
+		if c := a.DueDate.Compare(*b.DueDate); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.ID, a.ID)
+}
@@ -0,0 +1,538 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+// TaskRepository stores tasks. Methods that modify a task take an optional
+// expected version and fail with ErrVersionMismatch when the stored task has
+// moved on. Update and Patch fail with ErrParentCycle when the new parent is
+// the task itself or one of its subtasks.
+//
+// Create, Update and Patch write the task's tags along with it: Create
+// always, Update when task.Tags is not nil and Patch when the patch sets
+// Tags. Tags without an ID are created on the way, so a failed write leaves
+// no new tags behind. The names of the written tags end up in task.Tags.
+type TaskRepository interface {
+	Create(ctx context.Context, task *models.Task, tags []*models.Tag) error
+	List(ctx context.Context, filter TaskFilter) ([]*models.Task, error)
+	GetByID(ctx context.Context, taskID int, userID int) (*models.Task, error)
+	Update(ctx context.Context, task *models.Task, tags []*models.Tag, ifVersion *int) error
+	Delete(ctx context.Context, taskID int, userID int, ifVersion *int) error
+	Patch(ctx context.Context, taskID int, userID int, patch models.TaskPatch, tags []*models.Tag, ifVersion *int) (*models.Task, error)
+	Search(ctx context.Context, userID int, query string, limit int) ([]*models.TaskSearchResult, error)
+	// Subtree returns the task followed by all its subtasks at any depth,
+	// shallowest first.
+	Subtree(ctx context.Context, taskID int, userID int) ([]*models.Task, error)
+	// Progress counts the subtasks below each of the given tasks. Tasks
+	// without subtasks are left out.
+	Progress(ctx context.Context, userID int, taskIDs []int) (map[int]*models.TaskProgress, error)
+	// Matrix sorts the user's open tasks, subtasks included, into the
+	// quadrants of an Eisenhower matrix and keeps the first limit tasks of
+	// each, ordered as compareMatrixTasks does.
+	Matrix(ctx context.Context, userID int, urgentBefore time.Time, limit int) ([4]TaskQuadrant, error)
+	// CompleteSubtasks marks every open subtask below the task completed.
+	CompleteSubtasks(ctx context.Context, taskID int, userID int) error
+	// ReopenAncestors marks every completed task above the task open again.
+	ReopenAncestors(ctx context.Context, taskID int, userID int) error
+	// Stats counts the tasks of all users.
+	Stats(ctx context.Context) (*models.TaskStats, error)
+}
+
+const taskColumns = `id, user_id, title, description, category_id, parent_id, completed, priority, created_at, due_date, version, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTask reads a row selected with taskColumns followed by any extra
+// columns.
+func scanTask(row rowScanner, extra ...any) (*models.Task, error) {
+	var t models.Task
+	dest := append([]any{&t.ID, &t.UserID, &t.Title, &t.Description, &t.CategoryID, &t.ParentID, &t.Completed, &t.Priority, &t.CreatedAt, &t.DueDate, &t.Version, &t.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+type PostgresTaskRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresTaskRepository(db *sql.DB) *PostgresTaskRepository {
+	return &PostgresTaskRepository{DB: db}
+}
+
+func (r *PostgresTaskRepository) Create(ctx context.Context, task *models.Task, tags []*models.Tag) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO tasks (user_id, title, description, category_id, parent_id, completed, priority, due_date)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id, created_at, version, updated_at`
+	err = tx.QueryRowContext(ctx, query, task.UserID, task.Title, task.Description, task.CategoryID, task.ParentID, task.Completed, task.Priority, task.DueDate).Scan(&task.ID, &task.CreatedAt, &task.Version, &task.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := replaceTaskTags(ctx, tx, task, tags); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	task.Tags = tagNames(tags)
+	return nil
+}
+
+func (r *PostgresTaskRepository) List(ctx context.Context, filter TaskFilter) ([]*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE user_id = $1`
+	args := []any{filter.UserID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.CategoryID != nil {
+		query += " AND category_id = " + arg(*filter.CategoryID)
+	}
+	if filter.ParentID != nil {
+		query += " AND parent_id = " + arg(*filter.ParentID)
+	}
+	if filter.TopLevel {
+		query += " AND parent_id IS NULL"
+	}
+	if len(filter.TagIDs) > 0 {
+		tagged := "SELECT COUNT(*) FROM task_tags WHERE task_id = tasks.id AND tag_id = ANY(" + arg(pq.Array(filter.TagIDs)) + ")"
+		if filter.AllTags {
+			query += fmt.Sprintf(" AND (%s) = %s", tagged, arg(len(filter.TagIDs)))
+		} else {
+			query += fmt.Sprintf(" AND (%s) > 0", tagged)
+		}
+	}
+	if filter.Completed != nil {
+		query += " AND completed = " + arg(*filter.Completed)
+	}
+	if filter.DueBefore != nil {
+		query += " AND due_date < " + arg(*filter.DueBefore)
+	}
+	if filter.DueAfter != nil {
+		query += " AND due_date > " + arg(*filter.DueAfter)
+	}
+	if filter.Overdue {
+		query += " AND completed = FALSE AND due_date < CURRENT_TIMESTAMP"
+	}
+	if filter.Query != "" {
+		query += ` AND title ILIKE ` + arg("%"+escapeLike(filter.Query)+"%") + ` ESCAPE '\'`
+	}
+
+	sortExpr, sortType := sortColumn(filter.Sort, filter.Descending)
+	dir, cmp := "ASC", ">"
+	if filter.Descending {
+		dir, cmp = "DESC", "<"
+	}
+
+	if filter.Cursor != nil {
+		query += fmt.Sprintf(" AND (%s, id) %s (%s::%s, %s)", sortExpr, cmp, arg(filter.Cursor.Value), sortType, arg(filter.Cursor.ID))
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", sortExpr, dir, dir)
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// sortColumn returns the ORDER BY expression for the sort and the SQL type of
+// its cursor value. Tasks without a due date always sort last.
+func sortColumn(sort TaskSort, desc bool) (string, string) {
+	switch sort {
+	case SortDueDate:
+		if desc {
+			return "COALESCE(due_date, '-infinity'::timestamp)", "timestamp"
+		}
+		return "COALESCE(due_date, 'infinity'::timestamp)", "timestamp"
+	case SortTitle:
+		return "title", "text"
+	case SortPriority:
+		return "priority", "smallint"
+	default:
+		return "created_at", "timestamp"
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (r *PostgresTaskRepository) GetByID(ctx context.Context, taskID int, userID int) (*models.Task, error) {
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE id = $1 AND user_id = $2`
+	return scanTask(r.DB.QueryRowContext(ctx, query, taskID, userID))
+}
+
+func (r *PostgresTaskRepository) Update(ctx context.Context, task *models.Task, tags []*models.Tag, ifVersion *int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkParent(ctx, tx, task.ID, task.UserID, task.ParentID); err != nil {
+		return err
+	}
+	query := `UPDATE tasks SET title = $1, description = $2, category_id = $3, parent_id = $4, completed = $5, priority = $6, due_date = $7,
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8 AND user_id = $9 AND ($10::int IS NULL OR version = $10)
+		RETURNING created_at, version, updated_at`
+	err = tx.QueryRowContext(ctx, query, task.Title, task.Description, task.CategoryID, task.ParentID, task.Completed, task.Priority, task.DueDate, task.ID, task.UserID, ifVersion).Scan(&task.CreatedAt, &task.Version, &task.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.missing(ctx, task.ID, task.UserID)
+	}
+	if err != nil {
+		return err
+	}
+	if task.Tags != nil {
+		if err := replaceTaskTags(ctx, tx, task, tags); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if task.Tags != nil {
+		task.Tags = tagNames(tags)
+	}
+	return nil
+}
+
+// checkParent fails with ErrParentCycle when parentID is the task or one of
+// its subtasks. Moves of one user's tasks take turns on a lock of the user's
+// row, so two concurrent moves cannot close a cycle that neither of them
+// sees. Clearing the parent needs neither.
+func checkParent(ctx context.Context, tx *sql.Tx, taskID int, userID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	// NO KEY UPDATE leaves the key share locks of task inserts alone.
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID); err != nil {
+		return err
+	}
+	var cycle bool
+	query := `WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM tasks WHERE id = $1 AND user_id = $3
+			UNION ALL
+			SELECT t.id, t.parent_id FROM tasks t JOIN ancestors a ON t.id = a.parent_id WHERE t.user_id = $3
+		) CYCLE id SET is_cycle USING path
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+	if err := tx.QueryRowContext(ctx, query, *parentID, taskID, userID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrParentCycle
+	}
+	return nil
+}
+
+func (r *PostgresTaskRepository) Delete(ctx context.Context, taskID int, userID int, ifVersion *int) error {
+	query := `DELETE FROM tasks WHERE id = $1 AND user_id = $2 AND ($3::int IS NULL OR version = $3)`
+	res, err := r.DB.ExecContext(ctx, query, taskID, userID, ifVersion)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	return r.missing(ctx, taskID, userID)
+}
+
+// Patch updates only the fields set in the patch with a single statement and
+// returns the task as stored afterwards.
+func (r *PostgresTaskRepository) Patch(ctx context.Context, taskID int, userID int, patch models.TaskPatch, tags []*models.Tag, ifVersion *int) (*models.Task, error) {
+	if patch.Empty() {
+		task, err := r.GetByID(ctx, taskID, userID)
+		if err == nil && ifVersion != nil && task.Version != *ifVersion {
+			return nil, ErrVersionMismatch
+		}
+		return task, err
+	}
+
+	var sets []string
+	var args []any
+	set := func(column string, v any) {
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if patch.Title.Set {
+		set("title", patch.Title.Value)
+	}
+	if patch.Description.Set {
+		set("description", patch.Description.Value)
+	}
+	if patch.CategoryID.Set {
+		set("category_id", patch.CategoryID.Value)
+	}
+	if patch.ParentID.Set {
+		set("parent_id", patch.ParentID.Value)
+	}
+	if patch.DueDate.Set {
+		set("due_date", patch.DueDate.Value)
+	}
+	if patch.Completed.Set {
+		set("completed", patch.Completed.Value)
+	}
+	if patch.Priority.Set {
+		set("priority", patch.Priority.Value)
+	}
+	sets = append(sets, "version = version + 1", "updated_at = CURRENT_TIMESTAMP")
+
+	args = append(args, taskID, userID, ifVersion)
+	n := len(args)
+	query := fmt.Sprintf(`UPDATE tasks SET %s WHERE id = $%d AND user_id = $%d AND ($%d::int IS NULL OR version = $%d)
+		RETURNING %s`, strings.Join(sets, ", "), n-2, n-1, n, n, taskColumns)
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if patch.ParentID.Set {
+		if err := checkParent(ctx, tx, taskID, userID, patch.ParentID.Value); err != nil {
+			return nil, err
+		}
+	}
+	task, err := scanTask(tx.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, ErrNotFound) {
+		return nil, r.missing(ctx, taskID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if patch.Tags.Set {
+		if err := replaceTaskTags(ctx, tx, task, tags); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if patch.Tags.Set {
+		task.Tags = tagNames(tags)
+	}
+	return task, nil
+}
+
+// missing explains why a conditional write touched no rows: either the task
+// does not exist for the user or its version did not match.
+func (r *PostgresTaskRepository) missing(ctx context.Context, taskID int, userID int) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND user_id = $2)`
+	if err := r.DB.QueryRowContext(ctx, query, taskID, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
+
+func (r *PostgresTaskRepository) Search(ctx context.Context, userID int, query string, limit int) ([]*models.TaskSearchResult, error) {
+	tsquery := prefixTSQuery(query)
+	if tsquery == "" {
+		return nil, nil
+	}
+
+	sqlQuery := `SELECT ` + taskColumns + `,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('simple', title || ' ' || coalesce(description, ''), q, $3) AS snippet
+		FROM tasks, to_tsquery('simple', $2) q
+		WHERE user_id = $1 AND search_vector @@ q
+		ORDER BY rank DESC, id DESC
+		LIMIT $4`
+	rows, err := r.DB.QueryContext(ctx, sqlQuery, userID, tsquery, headlineOptions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.TaskSearchResult
+	for rows.Next() {
+		res := &models.TaskSearchResult{}
+		res.Task, err = scanTask(rows, &res.Rank, &res.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+func (r *PostgresTaskRepository) Subtree(ctx context.Context, taskID int, userID int) ([]*models.Task, error) {
+	query := `WITH RECURSIVE subtree AS (
+			SELECT id, 0 AS depth FROM tasks WHERE id = $1 AND user_id = $2
+			UNION ALL
+			SELECT t.id, s.depth + 1 FROM tasks t JOIN subtree s ON t.parent_id = s.id WHERE t.user_id = $2
+		) CYCLE id SET is_cycle USING path
+		SELECT ` + taskColumns + ` FROM tasks JOIN subtree USING (id)
+		WHERE NOT subtree.is_cycle
+		ORDER BY subtree.depth, created_at, id`
+	rows, err := r.DB.QueryContext(ctx, query, taskID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, ErrNotFound
+	}
+	return tasks, nil
+}
+
+func (r *PostgresTaskRepository) Progress(ctx context.Context, userID int, taskIDs []int) (map[int]*models.TaskProgress, error) {
+	progress := make(map[int]*models.TaskProgress)
+	if len(taskIDs) == 0 {
+		return progress, nil
+	}
+	query := `WITH RECURSIVE descendants AS (
+			SELECT parent_id AS root_id, id, completed FROM tasks WHERE user_id = $1 AND parent_id = ANY($2)
+			UNION ALL
+			SELECT d.root_id, t.id, t.completed FROM tasks t JOIN descendants d ON t.parent_id = d.id
+			WHERE t.user_id = $1 AND t.id <> d.root_id
+		) CYCLE id SET is_cycle USING path
+		SELECT root_id, COUNT(*), COUNT(*) FILTER (WHERE completed) FROM descendants
+		WHERE NOT is_cycle GROUP BY root_id`
+	rows, err := r.DB.QueryContext(ctx, query, userID, pq.Array(taskIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, subtasks, completed int
+		if err := rows.Scan(&id, &subtasks, &completed); err != nil {
+			return nil, err
+		}
+		progress[id] = models.NewTaskProgress(subtasks, completed)
+	}
+	return progress, rows.Err()
+}
+
+func (r *PostgresTaskRepository) CompleteSubtasks(ctx context.Context, taskID int, userID int) error {
+	query := `WITH RECURSIVE descendants AS (
+			SELECT id FROM tasks WHERE parent_id = $1 AND user_id = $2
+			UNION ALL
+			SELECT t.id FROM tasks t JOIN descendants d ON t.parent_id = d.id WHERE t.user_id = $2
+		) CYCLE id SET is_cycle USING path
+		UPDATE tasks SET completed = TRUE, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT id FROM descendants) AND NOT completed`
+	_, err := r.DB.ExecContext(ctx, query, taskID, userID)
+	return err
+}
+
+func (r *PostgresTaskRepository) ReopenAncestors(ctx context.Context, taskID int, userID int) error {
+	query := `WITH RECURSIVE ancestors AS (
+			SELECT parent_id AS id FROM tasks WHERE id = $1 AND user_id = $2 AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT t.parent_id FROM tasks t JOIN ancestors a ON t.id = a.id WHERE t.user_id = $2 AND t.parent_id IS NOT NULL
+		) CYCLE id SET is_cycle USING path
+		UPDATE tasks SET completed = FALSE, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (SELECT id FROM ancestors) AND user_id = $2 AND completed`
+	_, err := r.DB.ExecContext(ctx, query, taskID, userID)
+	return err
+}
+
+func (r *PostgresTaskRepository) Matrix(ctx context.Context, userID int, urgentBefore time.Time, limit int) ([4]TaskQuadrant, error) {
+	// The CASE mirrors QuadrantOf.
+	query := fmt.Sprintf(`SELECT %s, quadrant, total FROM (
+			SELECT *,
+				row_number() OVER (PARTITION BY quadrant ORDER BY due_date ASC NULLS LAST, priority DESC, id DESC) AS place,
+				COUNT(*) OVER (PARTITION BY quadrant) AS total
+			FROM (
+				SELECT %s,
+					CASE
+						WHEN priority >= $3 AND (priority = $4 OR due_date < $2) THEN %d
+						WHEN priority >= $3 THEN %d
+						WHEN due_date < $2 THEN %d
+						ELSE %d
+					END AS quadrant
+				FROM tasks WHERE user_id = $1 AND NOT completed
+			) classified
+		) ranked
+		WHERE place <= $5
+		ORDER BY quadrant, place`,
+		taskColumns, taskColumns, QuadrantDo, QuadrantSchedule, QuadrantDelegate, QuadrantEliminate)
+	var matrix [4]TaskQuadrant
+	rows, err := r.DB.QueryContext(ctx, query, userID, urgentBefore, models.PriorityHigh, models.PriorityUrgent, limit)
+	if err != nil {
+		return matrix, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q Quadrant
+		var total int
+		t, err := scanTask(rows, &q, &total)
+		if err != nil {
+			return matrix, err
+		}
+		matrix[q].Tasks = append(matrix[q].Tasks, t)
+		matrix[q].Total = total
+	}
+	return matrix, rows.Err()
+}
+
+func (r *PostgresTaskRepository) Stats(ctx context.Context) (*models.TaskStats, error) {
+	query := `SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE completed),
+			COUNT(*) FILTER (WHERE NOT completed),
+			COUNT(*) FILTER (WHERE NOT completed AND due_date < CURRENT_TIMESTAMP)
+		FROM tasks`
+	var stats models.TaskStats
+	err := r.DB.QueryRowContext(ctx, query).Scan(&stats.Total, &stats.Completed, &stats.Open, &stats.Overdue)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
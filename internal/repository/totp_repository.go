@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+type TOTPRepository struct {
+	DB *sql.DB
+}
+
+func NewTOTPRepository(db *sql.DB) *TOTPRepository {
+	return &TOTPRepository{DB: db}
+}
+
+func (r *TOTPRepository) Get(ctx context.Context, userID int) (*models.TOTP, error) {
+	query := `SELECT user_id, secret, created_at, enabled_at, last_step FROM user_totp WHERE user_id = $1`
+	var t models.TOTP
+	err := r.DB.QueryRowContext(ctx, query, userID).Scan(&t.UserID, &t.Secret, &t.CreatedAt, &t.EnabledAt, &t.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SavePending stores a new secret awaiting confirmation, replacing an
+// earlier unconfirmed one. It returns ErrDuplicate when TOTP is already
+// enabled for the user.
+func (r *TOTPRepository) SavePending(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = CURRENT_TIMESTAMP, last_step = NULL
+		WHERE user_totp.enabled_at IS NULL`
+	res, err := r.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// Enable confirms the pending enrollment and replaces the recovery codes in
+// one transaction.
+func (r *TOTPRepository) Enable(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP, last_step = $2 WHERE user_id = $1 AND enabled_at IS NULL`
+	res, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the enrollment together with the recovery codes.
+func (r *TOTPRepository) Delete(ctx context.Context, userID int) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep records that a code for step was accepted. It fails with
+// ErrTokenAlreadyUsed unless step is newer than every step used before.
+func (r *TOTPRepository) UseStep(ctx context.Context, userID int, step int64) error {
+	query := `UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND (last_step IS NULL OR last_step < $2)`
+	res, err := r.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTokenAlreadyUsed
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused code as used, or returns ErrNotFound.
+func (r *TOTPRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	query := `UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.DB.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *TOTPRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left.
+func (r *TOTPRepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
 )
@@ -15,16 +16,12 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) Create(user *models.User) error {
-	query := `INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id, created_at`
-	err := r.DB.QueryRow(query, user.Username, user.PasswordHash).Scan(&user.ID, &user.CreatedAt)
-	return err
-}
+const userColumns = `id, username, COALESCE(email, ''), password_hash, created_at, role, disabled_at, password_reset_required, email_verified_at, deletion_requested_at`
 
-func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+// scanUser returns nil without an error when the row does not exist.
+func scanUser(row rowScanner) (*models.User, error) {
 	user := &models.User{}
-	query := `SELECT id, username, password_hash, created_at FROM users WHERE username = $1`
-	err := r.DB.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.Role, &user.DisabledAt, &user.PasswordResetRequired, &user.EmailVerifiedAt, &user.DeletionRequestedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -32,4 +29,148 @@ func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
 		return nil, err
 	}
 	return user, nil
-}
\ No newline at end of file
+}
+
+func (r *UserRepository) Create(user *models.User) error {
+	query := `INSERT INTO users (username, email, password_hash) VALUES ($1, NULLIF($2, ''), $3) RETURNING id, created_at, role`
+	err := r.DB.QueryRow(query, user.Username, user.Email, user.PasswordHash).Scan(&user.ID, &user.CreatedAt, &user.Role)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return scanUser(r.DB.QueryRow(query, username))
+}
+
+// GetByEmail matches the address case-insensitively.
+func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+	return scanUser(r.DB.QueryRow(query, email))
+}
+
+func (r *UserRepository) GetByID(id int) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(r.DB.QueryRow(query, id))
+}
+
+// List returns a page of users whose username or email contains search,
+// together with the number of matching users.
+func (r *UserRepository) List(search string, limit, offset int) ([]*models.User, int, error) {
+	pattern := "%" + escapeLike(search) + "%"
+
+	var total int
+	err := r.DB.QueryRow(`SELECT COUNT(*) FROM users WHERE username ILIKE $1 OR email ILIKE $1`, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE username ILIKE $1 OR email ILIKE $1 ORDER BY id LIMIT $2 OFFSET $3`
+	rows, err := r.DB.Query(query, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *UserRepository) Count() (int, error) {
+	var n int
+	err := r.DB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+// UpdatePassword stores a new password hash and lifts a forced reset.
+func (r *UserRepository) UpdatePassword(id int, passwordHash string) error {
+	return r.exec(`UPDATE users SET password_hash = $1, password_reset_required = FALSE WHERE id = $2`, passwordHash, id)
+}
+
+// SetEmail changes the address and marks it unverified again.
+func (r *UserRepository) SetEmail(id int, email string) error {
+	err := r.exec(`UPDATE users SET email = $1, email_verified_at = NULL WHERE id = $2`, email, id)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// MarkEmailVerified verifies the user's address if it is still email.
+func (r *UserRepository) MarkEmailVerified(id int, email string) error {
+	return r.exec(`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND LOWER(email) = LOWER($2)`, id, email)
+}
+
+// RequestDeletion schedules the account for purging and returns when the
+// request was made. Repeated requests keep the original time.
+func (r *UserRepository) RequestDeletion(id int) (time.Time, error) {
+	var requestedAt time.Time
+	query := `UPDATE users SET deletion_requested_at = COALESCE(deletion_requested_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 RETURNING deletion_requested_at`
+	err := r.DB.QueryRow(query, id).Scan(&requestedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	}
+	return requestedAt, err
+}
+
+func (r *UserRepository) CancelDeletion(id int) error {
+	return r.exec(`UPDATE users SET deletion_requested_at = NULL WHERE id = $1`, id)
+}
+
+// PurgeDeletionsRequestedBefore hard deletes the accounts whose deletion was
+// requested before cutoff. Their data goes with them through ON DELETE
+// CASCADE; audit entries are kept but stripped of personal data.
+func (r *UserRepository) PurgeDeletionsRequestedBefore(cutoff time.Time) (int64, error) {
+	query := `WITH doomed AS (
+			SELECT id FROM users WHERE deletion_requested_at < $1
+		), scrubbed AS (
+			UPDATE audit_log SET ip = NULL, metadata = metadata - 'username' - 'user_agent'
+			WHERE actor_id IN (SELECT id FROM doomed) OR target_user_id IN (SELECT id FROM doomed)
+		)
+		DELETE FROM users WHERE id IN (SELECT id FROM doomed)`
+	res, err := r.DB.Exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *UserRepository) SetRole(id int, role string) error {
+	return r.exec(`UPDATE users SET role = $1 WHERE id = $2`, role, id)
+}
+
+func (r *UserRepository) SetDisabled(id int, disabled bool) error {
+	query := `UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END WHERE id = $2`
+	return r.exec(query, disabled, id)
+}
+
+func (r *UserRepository) SetPasswordResetRequired(id int, required bool) error {
+	return r.exec(`UPDATE users SET password_reset_required = $1 WHERE id = $2`, required, id)
+}
+
+// exec runs an update of a single user and reports ErrNotFound when the user
+// does not exist.
+func (r *UserRepository) exec(query string, args ...any) error {
+	res, err := r.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
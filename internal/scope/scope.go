@@ -0,0 +1,60 @@
+package scope
+
+import "strings"
+
+const (
+	TasksRead       = "tasks:read"
+	TasksWrite      = "tasks:write"
+	CategoriesRead  = "categories:read"
+	CategoriesWrite = "categories:write"
+	// Account lets a token manage the account itself: its profile,
+	// credentials, sessions and API tokens. Only tokens from an
+	// interactive login carry it.
+	Account = "account"
+	// PasswordChange only lets a token change the password. It is all a
+	// user gets at login while an admin forces a password reset.
+	PasswordChange = "password:change"
+	// Admin grants every other scope as well, except Account and
+	// PasswordChange.
+	Admin = "admin"
+)
+
+// All lists every scope an API token can be granted. Account,
+// PasswordChange and Admin are left out on purpose: a leaked token that
+// never expires must not be able to run the whole instance.
+var All = []string{TasksRead, TasksWrite, CategoriesRead, CategoriesWrite}
+
+// Data covers the user's tasks and categories. Impersonation tokens get
+// nothing more.
+var Data = []string{TasksRead, TasksWrite, CategoriesRead, CategoriesWrite}
+
+// Default is granted to users when they log in.
+var Default = []string{TasksRead, TasksWrite, CategoriesRead, CategoriesWrite, Account}
+
+func Valid(s string) bool {
+	for _, known := range All {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the granted scopes satisfy the required one.
+func Has(granted []string, required string) bool {
+	for _, g := range granted {
+		if g == required || (g == Admin && required != Account && required != PasswordChange) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse splits a space separated scope claim as used by OAuth 2.0.
+func Parse(s string) []string {
+	return strings.Fields(s)
+}
+
+func Format(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const (
+	AuditDeletionRequested = "user.deletion_requested"
+	AuditDeletionCancelled = "user.deletion_cancelled"
+)
+
+// exportPageSize is how many tasks an export reads per query.
+const exportPageSize = 500
+
+// AccountService deletes accounts and exports their data. Deleted accounts
+// are kept for a grace period during which logging in again restores them.
+type AccountService struct {
+	Users         *repository.UserRepository
+	RefreshTokens *repository.RefreshTokenRepository
+	Credentials   *CredentialChecker
+	Audit         *repository.AuditRepository
+	Profiles      *ProfileService
+	Tasks         repository.TaskRepository
+	Categories    repository.CategoryRepository
+	Tags          repository.TagRepository
+	Grace         time.Duration
+}
+
+func NewAccountService(users *repository.UserRepository, refreshTokens *repository.RefreshTokenRepository, credentials *CredentialChecker, audit *repository.AuditRepository, profiles *ProfileService, tasks repository.TaskRepository, categories repository.CategoryRepository, tags repository.TagRepository, grace time.Duration) *AccountService {
+	return &AccountService{
+		Users:         users,
+		RefreshTokens: refreshTokens,
+		Credentials:   credentials,
+		Audit:         audit,
+		Profiles:      profiles,
+		Tasks:         tasks,
+		Categories:    categories,
+		Tags:          tags,
+		Grace:         grace,
+	}
+}
+
+// DeleteAccount schedules the account for deletion once the owner confirmed
+// it as CredentialChecker.Confirm describes. The user is signed out
+// everywhere and the time the account will be purged is returned.
+func (s *AccountService) DeleteAccount(ctx context.Context, actor Actor, password, code string) (time.Time, error) {
+	user, err := s.Users.GetByID(actor.UserID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user == nil {
+		return time.Time{}, ErrNotFound
+	}
+
+	if err := s.Credentials.Confirm(ctx, actor, user, "password", password, code); err != nil {
+		return time.Time{}, err
+	}
+
+	requestedAt, err := s.Users.RequestDeletion(user.ID)
+	if err != nil {
+		return time.Time{}, mapRepoError(err)
+	}
+	if err := s.RefreshTokens.RevokeAllForUser(ctx, user.ID); err != nil {
+		return time.Time{}, err
+	}
+	purgeAt := requestedAt.Add(s.Grace)
+	if err := recordAudit(ctx, s.Audit, actor, AuditDeletionRequested, user.ID, map[string]any{"purge_at": purgeAt}); err != nil {
+		return time.Time{}, err
+	}
+	return purgeAt, nil
+}
+
+// PurgeDeleted removes the accounts whose grace period is over.
+func (s *AccountService) PurgeDeleted(ctx context.Context) (int64, error) {
+	return s.Users.PurgeDeletionsRequestedBefore(time.Now().Add(-s.Grace))
+}
+
+// RunPurge calls PurgeDeleted every interval until ctx is done.
+func (s *AccountService) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.PurgeDeleted(ctx)
+			if err != nil {
+				log.Printf("purge deleted accounts: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted accounts", n)
+			}
+		}
+	}
+}
+
+// UserExport is everything the service stores on behalf of a user that is
+// worth handing back to them.
+type UserExport struct {
+	Profile    *models.Profile
+	Categories []*models.Category
+	Tags       []*models.Tag
+	Tasks      []*models.Task
+	ExportedAt time.Time
+}
+
+func (s *AccountService) Export(ctx context.Context, userID int) (*UserExport, error) {
+	profile, err := s.Profiles.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.Categories.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if categories == nil {
+		categories = []*models.Category{}
+	}
+	tags, err := s.Tags.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = []*models.Tag{}
+	}
+
+	tasks := []*models.Task{}
+	filter := repository.TaskFilter{UserID: userID, Sort: repository.SortCreatedAt, Limit: exportPageSize}
+	for {
+		page, err := s.Tasks.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int, len(page))
+		for i, t := range page {
+			ids[i] = t.ID
+		}
+		taskTags, err := s.Tags.TaskTags(ctx, userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			t.Tags = taskTags[t.ID]
+		}
+		tasks = append(tasks, page...)
+		if len(page) < exportPageSize {
+			break
+		}
+		filter.Cursor = repository.NewTaskCursor(page[len(page)-1], filter.Sort, filter.Descending)
+	}
+
+	return &UserExport{Profile: profile, Categories: categories, Tags: tags, Tasks: tasks, ExportedAt: time.Now().UTC()}, nil
+}
+
+// WriteZip writes the export as a ZIP archive holding profile.json,
+// categories.json, tags.json and tasks.json.
+func (e *UserExport) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", e.Profile},
+		{"categories.json", e.Categories},
+		{"tags.json", e.Tags},
+		{"tasks.json", e.Tasks},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+// Audit actions recorded by the admin API.
+const (
+	AuditRoleChanged         = "user.role_changed"
+	AuditUserDisabled        = "user.disabled"
+	AuditUserEnabled         = "user.enabled"
+	AuditPasswordResetForced = "user.password_reset_forced"
+	AuditUserImpersonated    = "user.impersonated"
+)
+
+const (
+	defaultAdminPageSize = 20
+	maxAdminPageSize     = 100
+	defaultAuditLimit    = 50
+)
+
+type AdminService struct {
+	Users         *repository.UserRepository
+	Tasks         repository.TaskRepository
+	RefreshTokens *repository.RefreshTokenRepository
+	APITokens     *repository.APITokenRepository
+	Audit         *repository.AuditRepository
+	Auth          *AuthService
+}
+
+func NewAdminService(users *repository.UserRepository, tasks repository.TaskRepository, refreshTokens *repository.RefreshTokenRepository, apiTokens *repository.APITokenRepository, audit *repository.AuditRepository, auth *AuthService) *AdminService {
+	return &AdminService{
+		Users:         users,
+		Tasks:         tasks,
+		RefreshTokens: refreshTokens,
+		APITokens:     apiTokens,
+		Audit:         audit,
+		Auth:          auth,
+	}
+}
+
+// Actor identifies the user performing an action, for the audit log.
+type Actor struct {
+	UserID int
+	IP     string
+	// SessionID is the login session of the access token, empty for API
+	// and impersonation tokens.
+	SessionID string
+	// ImpersonatorID is the admin acting as UserID through an
+	// impersonation token.
+	ImpersonatorID *int
+}
+
+type UserPage struct {
+	Users  []*models.User `json:"data"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+type SystemStats struct {
+	Users int               `json:"users"`
+	Tasks *models.TaskStats `json:"tasks"`
+}
+
+// IsAdmin reports whether the user currently has the admin role. It is
+// looked up on every request so demoting an admin takes effect immediately.
+func (s *AdminService) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	user, err := s.Users.GetByID(userID)
+	if err != nil || user == nil {
+		return false, err
+	}
+	return user.Role == models.RoleAdmin && user.DisabledAt == nil, nil
+}
+
+func (s *AdminService) ListUsers(ctx context.Context, search string, limit, offset int) (*UserPage, error) {
+	if limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	users, total, err := s.Users.List(search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	return &UserPage{Users: users, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+func (s *AdminService) GetUser(ctx context.Context, id int) (*models.User, error) {
+	user, err := s.Users.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *AdminService) SetRole(ctx context.Context, actor Actor, id int, role string) (*models.User, error) {
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, NewValidationError("role", "must be user or admin")
+	}
+	if id == actor.UserID && role != models.RoleAdmin {
+		return nil, fmt.Errorf("admins cannot demote themselves: %w", ErrConflict)
+	}
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Users.SetRole(id, role); err != nil {
+		return nil, mapRepoError(err)
+	}
+	if err := s.record(ctx, actor, AuditRoleChanged, id, map[string]any{"from": user.Role, "to": role}); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return user, nil
+}
+
+// Disable blocks the account from logging in and revokes its sessions,
+// which rejects the access tokens issued for them at once. API tokens of
+// disabled users stop working too. Only impersonation tokens, which have no
+// session, stay valid for the rest of ImpersonationTTL.
+func (s *AdminService) Disable(ctx context.Context, actor Actor, id int) error {
+	if id == actor.UserID {
+		return fmt.Errorf("admins cannot disable themselves: %w", ErrConflict)
+	}
+	if err := s.Users.SetDisabled(id, true); err != nil {
+		return mapRepoError(err)
+	}
+	if err := s.RefreshTokens.RevokeAllForUser(ctx, id); err != nil {
+		return err
+	}
+	return s.record(ctx, actor, AuditUserDisabled, id, nil)
+}
+
+func (s *AdminService) Enable(ctx context.Context, actor Actor, id int) error {
+	if err := s.Users.SetDisabled(id, false); err != nil {
+		return mapRepoError(err)
+	}
+	return s.record(ctx, actor, AuditUserEnabled, id, nil)
+}
+
+// ForcePasswordReset signs the user out everywhere and revokes their API
+// tokens. Until the password is changed, logging in only yields a token to
+// change it with. Users without a password log in through their identity
+// provider and have none to reset.
+func (s *AdminService) ForcePasswordReset(ctx context.Context, actor Actor, id int) error {
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !user.HasPassword() {
+		return fmt.Errorf("user has no password to reset: %w", ErrConflict)
+	}
+	if err := s.Users.SetPasswordResetRequired(id, true); err != nil {
+		return mapRepoError(err)
+	}
+	if err := s.RefreshTokens.RevokeAllForUser(ctx, id); err != nil {
+		return err
+	}
+	if err := s.APITokens.RevokeAllForUser(ctx, id); err != nil {
+		return err
+	}
+	return s.record(ctx, actor, AuditPasswordResetForced, id, nil)
+}
+
+// Impersonate issues a short-lived access token for the user. The token
+// names the admin in its "act" claim and comes without a refresh token.
+func (s *AdminService) Impersonate(ctx context.Context, actor Actor, id int) (string, *models.User, error) {
+	if id == actor.UserID {
+		return "", nil, NewValidationError("id", "cannot impersonate yourself")
+	}
+	user, err := s.GetUser(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if user.DisabledAt != nil {
+		return "", nil, ErrAccountDisabled
+	}
+	token, err := s.Auth.SignImpersonationToken(user, actor.UserID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.record(ctx, actor, AuditUserImpersonated, id, nil); err != nil {
+		return "", nil, err
+	}
+	return token, user, nil
+}
+
+func (s *AdminService) Stats(ctx context.Context) (*SystemStats, error) {
+	users, err := s.Users.Count()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.Tasks.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SystemStats{Users: users, Tasks: tasks}, nil
+}
+
+func (s *AdminService) AuditLog(ctx context.Context, action string, limit int) ([]*models.AuditEntry, error) {
+	if limit <= 0 || limit > maxAdminPageSize {
+		limit = defaultAuditLimit
+	}
+	entries, err := s.Audit.List(ctx, action, limit)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*models.AuditEntry{}
+	}
+	return entries, nil
+}
+
+func (s *AdminService) record(ctx context.Context, actor Actor, action string, targetID int, metadata map[string]any) error {
+	return recordAudit(ctx, s.Audit, actor, action, targetID, metadata)
+}
+
+func recordAudit(ctx context.Context, audit *repository.AuditRepository, actor Actor, action string, targetID int, metadata map[string]any) error {
+	if actor.ImpersonatorID != nil {
+		metadata = maps.Clone(metadata)
+		if metadata == nil {
+			metadata = map[string]any{}
+		}
+		metadata["impersonated_by"] = *actor.ImpersonatorID
+	}
+	return audit.Record(ctx, &models.AuditEntry{
+		ActorID:      &actor.UserID,
+		Action:       action,
+		TargetUserID: &targetID,
+		IP:           actor.IP,
+		Metadata:     metadata,
+	})
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+)
+
+// APITokenPrefix starts every personal access token so the auth middleware
+// can tell them apart from JWTs.
+const APITokenPrefix = "gtp_"
+
+var ErrInvalidAPIToken = fmt.Errorf("invalid, expired or revoked API token: %w", ErrUnauthorized)
+
+type APITokenService struct {
+	Repo *repository.APITokenRepository
+}
+
+func NewAPITokenService(repo *repository.APITokenRepository) *APITokenService {
+	return &APITokenService{Repo: repo}
+}
+
+// CreateToken stores a new token and returns it in plain text. This is the
+// only time the token can be read. A token never gets a scope that the
+// caller creating it does not hold, nor the account or admin scopes.
+func (s *APITokenService) CreateToken(ctx context.Context, userID int, callerScopes []string, name string, scopes []string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	verr := &ValidationError{}
+	if strings.TrimSpace(name) == "" {
+		verr.Add("name", "name is required")
+	}
+	if len(scopes) == 0 {
+		verr.Add("scopes", "at least one scope is required")
+	}
+	for _, sc := range scopes {
+		if sc == scope.Account || sc == scope.Admin {
+			verr.Add("scopes", fmt.Sprintf("scope %q cannot be granted to API tokens", sc))
+		} else if !scope.Valid(sc) {
+			verr.Add("scopes", fmt.Sprintf("unknown scope %q", sc))
+		} else if !scope.Has(callerScopes, sc) {
+			verr.Add("scopes", fmt.Sprintf("cannot grant scope %q you do not have", sc))
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		verr.Add("expires_at", "expiry cannot be in the past")
+	}
+	if err := verr.Err(); err != nil {
+		return "", nil, err
+	}
+
+	secret, _, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := APITokenPrefix + secret
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    raw[:len(APITokenPrefix)+8],
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.Repo.Create(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+func (s *APITokenService) ListTokens(ctx context.Context, userID int) ([]*models.APIToken, error) {
+	tokens, err := s.Repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []*models.APIToken{}
+	}
+	return tokens, nil
+}
+
+func (s *APITokenService) RevokeToken(ctx context.Context, tokenID int, userID int) error {
+	return mapRepoError(s.Repo.Revoke(ctx, tokenID, userID))
+}
+
+// VerifyAPIToken implements middleware.APITokenVerifier. Tokens created
+// while the admin scope could still be granted lose it here.
+func (s *APITokenService) VerifyAPIToken(ctx context.Context, raw string) (int, []string, error) {
+	token, err := s.Repo.Use(ctx, hashToken(raw))
+	if errors.Is(err, repository.ErrNotFound) {
+		return 0, nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	scopes := slices.DeleteFunc(slices.Clone(token.Scopes), func(sc string) bool {
+		return sc == scope.Admin
+	})
+	return token.UserID, scopes, nil
+}
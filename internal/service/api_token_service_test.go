@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+)
+
+func TestCreateTokenRejectsAccountAndAdminScopes(t *testing.T) {
+	s := NewAPITokenService(nil)
+	admin := append([]string{scope.Admin}, scope.Default...)
+
+	for _, sc := range []string{scope.Account, scope.Admin} {
+		_, _, err := s.CreateToken(context.Background(), 1, admin, "ci", []string{sc}, nil)
+		if got := validationFields(err); len(got) != 1 || got[0] != "scopes" {
+			t.Errorf("scope %q: err = %v, want a scopes validation error", sc, err)
+		}
+	}
+}
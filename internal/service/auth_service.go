@@ -1,49 +1,449 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/jwtkeys"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/scope"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/throttle"
 )
 
+var (
+	ErrInvalidRefreshToken = fmt.Errorf("invalid or expired refresh token: %w", ErrUnauthorized)
+	ErrAccountDisabled     = fmt.Errorf("account is disabled: %w", ErrForbidden)
+)
+
+// Values of the "typ" claim that tell access tokens from MFA challenges.
+const (
+	TokenTypeAccess = "access"
+	TokenTypeMFA    = "mfa"
+)
+
+// mfaChallengeTTL is how long a user has to enter their second factor.
+const mfaChallengeTTL = 5 * time.Minute
+
+// ImpersonationTTL is the fixed lifetime of impersonation tokens. They are
+// bound to no session, so nothing but expiry ends them.
+const ImpersonationTTL = 15 * time.Minute
+
+// passwordChangeTTL is how long a user whose password reset was forced has
+// to set a new password after logging in.
+const passwordChangeTTL = 10 * time.Minute
+
+const AuditLoginFailed = "login.failed"
+
+var (
+	ErrInvalidMFAToken = fmt.Errorf("invalid or expired MFA token: %w", ErrUnauthorized)
+	// ErrInvalidCredentials is returned for unknown users and wrong
+	// passwords alike so logins do not reveal which usernames exist.
+	ErrInvalidCredentials = fmt.Errorf("invalid username or password: %w", ErrUnauthorized)
+)
+
+// dummyPasswordHash is compared against when the user does not exist.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("go-tasks dummy password"), bcrypt.DefaultCost)
+
+// ClientInfo describes where a request came from, for throttling and the
+// audit log.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginLimits throttles failed logins per username and per client IP.
+type LoginLimits struct {
+	Users *throttle.Throttle
+	IPs   *throttle.Throttle
+}
+
+func (l LoginLimits) check(username, ip string) error {
+	wait := max(l.Users.Allow(throttleKey(username)), l.IPs.Allow(ip))
+	if wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (l LoginLimits) fail(username, ip string) bool {
+	userLocked := l.Users.Fail(throttleKey(username))
+	ipLocked := l.IPs.Fail(ip)
+	return userLocked || ipLocked
+}
+
+func throttleKey(username string) string {
+	return strings.ToLower(username)
+}
+
 type AuthService struct {
-	Repo      *repository.UserRepository
-	JWTSecret string
+	Repo          *repository.UserRepository
+	RefreshTokens *repository.RefreshTokenRepository
+	Sessions      *repository.SessionRepository
+	TOTP          *TOTPService
+	Audit         *repository.AuditRepository
+	Limits        LoginLimits
+	Keys          *jwtkeys.Manager
+	AccessTTL     time.Duration
+	RefreshTTL    time.Duration
 }
 
-func NewAuthService(repo *repository.UserRepository, secret string) *AuthService {
-	return &AuthService{Repo: repo, JWTSecret: secret}
+func NewAuthService(repo *repository.UserRepository, refreshTokens *repository.RefreshTokenRepository, sessions *repository.SessionRepository, totp *TOTPService, audit *repository.AuditRepository, limits LoginLimits, keys *jwtkeys.Manager, accessTTL, refreshTTL time.Duration) *AuthService {
+	return &AuthService{
+		Repo:          repo,
+		RefreshTokens: refreshTokens,
+		Sessions:      sessions,
+		TOTP:          totp,
+		Audit:         audit,
+		Limits:        limits,
+		Keys:          keys,
+		AccessTTL:     accessTTL,
+		RefreshTTL:    refreshTTL,
+	}
 }
 
-func (s *AuthService) Login(username, password string) (string, *models.User, error) {
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+// LoginResult holds either the issued tokens or, when the user has a second
+// factor, an MFA challenge token to pass to CompleteMFA.
+type LoginResult struct {
+	User   *models.User
+	Tokens *TokenPair
+	// MFAToken is set instead of Tokens when a second factor is required.
+	MFAToken     string
+	MFAExpiresIn int
+	// PasswordChangeToken is set instead of Tokens when an admin forced a
+	// password reset. It only works for changing the password.
+	PasswordChangeToken     string
+	PasswordChangeExpiresIn int
+}
+
+func (s *AuthService) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error) {
+	if err := s.Limits.check(username, client.IP); err != nil {
+		return nil, err
+	}
+
 	user, err := s.Repo.GetByUsername(username)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
 	if user == nil {
-		return "", nil, errors.New("user not found")
+		// Spend as long as for a real user so timing does not reveal
+		// whether the username exists.
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, s.loginFailed(ctx, nil, username, "unknown_user", client, ErrInvalidCredentials)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return "", nil, errors.New("invalid password")
+		return nil, s.loginFailed(ctx, user, username, "invalid_password", client, ErrInvalidCredentials)
 	}
+	return s.LoginAuthenticated(ctx, user, client)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
+// LoginAuthenticated logs in a user whose identity was already established,
+// by their password or by an external identity provider. A second factor is
+// still asked for when the user has one.
+func (s *AuthService) LoginAuthenticated(ctx context.Context, user *models.User, client ClientInfo) (*LoginResult, error) {
+	if err := checkCanLogin(user); err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.TOTP.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa {
+		token, err := s.signMFAToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, MFAToken: token, MFAExpiresIn: int(mfaChallengeTTL.Seconds())}, nil
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// CompleteMFA finishes a login that Login answered with an MFA token. The
+// code is a TOTP code or one of the user's recovery codes. Wrong codes count
+// as failed logins.
+func (s *AuthService) CompleteMFA(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	claims := jwt.MapClaims{}
+	token, err := s.Keys.Parse(mfaToken, claims)
+	if err != nil || !token.Valid || claims["typ"] != TokenTypeMFA {
+		return nil, ErrInvalidMFAToken
+	}
+	floatID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.Repo.GetByID(int(floatID))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := s.Limits.check(user.Username, client.IP); err != nil {
+		return nil, err
+	}
+	if err := checkCanLogin(user); err != nil {
+		return nil, err
+	}
+	err = s.TOTP.Verify(ctx, user.ID, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		return nil, s.loginFailed(ctx, user, user.Username, "invalid_mfa_code", client, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, client)
+}
+
+// loginFailed counts the failure against the username and the client IP,
+// records it in the audit log and returns result.
+func (s *AuthService) loginFailed(ctx context.Context, user *models.User, username, reason string, client ClientInfo, result error) error {
+	locked := s.Limits.fail(username, client.IP)
+
+	entry := &models.AuditEntry{
+		Action: AuditLoginFailed,
+		IP:     client.IP,
+		Metadata: map[string]any{
+			"username":   username,
+			"reason":     reason,
+			"user_agent": client.UserAgent,
+		},
+	}
+	if user != nil {
+		entry.TargetUserID = &user.ID
+	}
+	if locked {
+		entry.Metadata["locked"] = true
+	}
+	if err := s.Audit.Record(ctx, entry); err != nil {
+		log.Printf("record failed login: %v", err)
+	}
+	return result
+}
+
+func checkCanLogin(user *models.User) error {
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// startSession issues the first token pair of a new refresh token family,
+// which is the session of the client's device. Logging in to an account
+// that awaits deletion cancels the deletion. Users who have to reset their
+// password get no session, only a token to change the password with.
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client ClientInfo) (*LoginResult, error) {
+	if user.DeletionRequestedAt != nil {
+		if err := s.Repo.CancelDeletion(user.ID); err != nil {
+			return nil, err
+		}
+		user.DeletionRequestedAt = nil
+		if err := recordAudit(ctx, s.Audit, Actor{UserID: user.ID, IP: client.IP}, AuditDeletionCancelled, user.ID, nil); err != nil {
+			return nil, err
+		}
+	}
+	result := &LoginResult{User: user}
+	if user.PasswordResetRequired {
+		token, err := s.signPasswordChangeToken(user)
+		if err != nil {
+			return nil, err
+		}
+		result.PasswordChangeToken = token
+		result.PasswordChangeExpiresIn = int(passwordChangeTTL.Seconds())
+	} else {
+		familyID, err := randomID()
+		if err != nil {
+			return nil, err
+		}
+		if result.Tokens, err = s.issueTokens(ctx, user, familyID, nil, client); err != nil {
+			return nil, err
+		}
+	}
+	s.Limits.Users.Reset(throttleKey(user.Username))
+	return result, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once; presenting one that was already rotated means it leaked, so
+// the whole family it belongs to is revoked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error) {
+	current, err := s.RefreshTokens.GetByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		if err := s.RefreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reuse detected: %w", ErrUnauthorized)
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
 
-	tokenString, err := token.SignedString([]byte(s.JWTSecret))
+	user, err := s.Repo.GetByID(current.UserID)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if user.DisabledAt != nil || user.PasswordResetRequired {
+		if err := s.RefreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := s.issueTokens(ctx, user, current.FamilyID, current, client)
+	if errors.Is(err, repository.ErrTokenAlreadyUsed) {
+		// Lost a race with another refresh using the same token.
+		if err := s.RefreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reuse detected: %w", ErrUnauthorized)
+	}
+	return tokens, err
+}
 
-	return tokenString, user, nil
+// Logout revokes the session the refresh token belongs to. Unknown tokens
+// and tokens of other users are ignored so logging out is idempotent.
+func (s *AuthService) Logout(ctx context.Context, userID int, refreshToken string) error {
+	current, err := s.RefreshTokens.GetByHash(ctx, hashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.UserID != userID {
+		return nil
+	}
+	return s.RefreshTokens.RevokeFamily(ctx, current.FamilyID)
+}
+
+func (s *AuthService) LogoutAll(ctx context.Context, userID int) error {
+	return s.RefreshTokens.RevokeAllForUser(ctx, userID)
+}
+
+// issueTokens signs an access token and stores a new refresh token in the
+// family. When previous is set it is rotated out in the same step. The
+// session of the family is created or marked as seen from client.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, familyID string, previous *models.RefreshToken, client ClientInfo) (*TokenPair, error) {
+	accessToken, err := s.signAccessToken(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, hash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	next := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.RefreshTTL),
+	}
+	if previous != nil {
+		err = s.RefreshTokens.Rotate(ctx, previous, next)
+	} else {
+		err = s.RefreshTokens.Create(ctx, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		ID:        familyID,
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: next.ExpiresAt,
+	}
+	if err := s.Sessions.Save(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: raw,
+		ExpiresIn:    int(s.AccessTTL.Seconds()),
+	}, nil
+}
+
+// signAccessToken binds the token to the session sid so revoking the
+// session stops the token from working before it expires.
+func (s *AuthService) signAccessToken(user *models.User, sid string) (string, error) {
+	claims := s.accessClaims(user, userScopes(user), s.AccessTTL)
+	claims["sid"] = sid
+	return s.Keys.Sign(claims)
+}
+
+// SignImpersonationToken issues an access token that acts as user on behalf
+// of the admin actorID, recorded in the RFC 8693 "act" claim. It only
+// carries the data scopes, so it can neither administer nor manage the
+// account, and expires after ImpersonationTTL.
+func (s *AuthService) SignImpersonationToken(user *models.User, actorID int) (string, error) {
+	claims := s.accessClaims(user, scope.Data, ImpersonationTTL)
+	claims["act"] = map[string]any{"sub": actorID}
+	return s.Keys.Sign(claims)
+}
+
+// signPasswordChangeToken only lets the user change their password. It is
+// bound to no session and expires after passwordChangeTTL.
+func (s *AuthService) signPasswordChangeToken(user *models.User) (string, error) {
+	return s.Keys.Sign(s.accessClaims(user, []string{scope.PasswordChange}, passwordChangeTTL))
+}
+
+// signMFAToken proves that the password was checked. It is no access token;
+// the auth middleware rejects it because of its typ claim.
+func (s *AuthService) signMFAToken(user *models.User) (string, error) {
+	now := time.Now()
+	return s.Keys.Sign(jwt.MapClaims{
+		"user_id": user.ID,
+		"typ":     TokenTypeMFA,
+		"iat":     now.Unix(),
+		"exp":     now.Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+func (s *AuthService) accessClaims(user *models.User, scopes []string, ttl time.Duration) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"typ":      TokenTypeAccess,
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"scope":    scope.Format(scopes),
+		"iat":      now.Unix(),
+		"exp":      now.Add(ttl).Unix(),
+	}
+}
+
+func userScopes(user *models.User) []string {
+	if user.Role == models.RoleAdmin {
+		return append([]string{scope.Admin}, scope.Default...)
+	}
+	return scope.Default
 }
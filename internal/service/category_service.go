@@ -2,58 +2,41 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"strings"
+
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
 )
 
 type CategoryService struct {
-	DB *sql.DB
+	Repo repository.CategoryRepository
 }
 
-func NewCategoryService(db *sql.DB) *CategoryService {
+func NewCategoryService(repo repository.CategoryRepository) *CategoryService {
 	return &CategoryService{
-		DB: db,
+		Repo: repo,
 	}
 }
 
 func (s *CategoryService) CreateCategory(ctx context.Context, category *models.Category) error {
-	query := `INSERT INTO categories (user_id, name) VALUES ($1, $2) RETURNING id, created_at`
-	err := s.DB.QueryRowContext(ctx, query, category.UserID, category.Name).Scan(&category.ID, &category.CreatedAt)
-	return err
+	if strings.TrimSpace(category.Name) == "" {
+		return NewValidationError("name", "name is required")
+	}
+	return s.Repo.Create(ctx, category)
 }
 
 func (s *CategoryService) DeleteCategory(ctx context.Context, categoryId int, userId int) error {
-	query := `DELETE FROM categories WHERE id = $1 AND user_id = $2`
-	_, err := s.DB.ExecContext(ctx, query, categoryId, userId)
-	return err
+	return mapRepoError(s.Repo.Delete(ctx, categoryId, userId))
 }
 
 func (s *CategoryService) GetCategoriesByUser(ctx context.Context, userID int) ([]*models.Category, error) {
-	query := `SELECT id, user_id, name, created_at FROM categories WHERE user_id = $1 ORDER BY created_at DESC`
-	rows, err := s.DB.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var categories []*models.Category
-	for rows.Next() {
-		var c models.Category
-		err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		categories = append(categories, &c)
-	}
-	return categories, nil
+	return s.Repo.ListByUser(ctx, userID)
 }
 
 func (s *CategoryService) GetCategoryById(ctx context.Context, categoryId int, userID int) (*models.Category, error) {
-	query := `SELECT id, user_id, name, created_at FROM categories WHERE id = $1 AND user_id = $2`
-	row := s.DB.QueryRowContext(ctx, query, categoryId, userID)
-	var category models.Category
-	err := row.Scan(&category.ID, &category.UserID, &category.Name, &category.CreatedAt)
+	category, err := s.Repo.GetByID(ctx, categoryId, userID)
 	if err != nil {
-		return nil, err
+		return nil, mapRepoError(err)
 	}
-	return &category, nil
+	return category, nil
 }
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+func TestCreateCategoryRequiresName(t *testing.T) {
+	s := NewCategoryService(repository.NewMemoryCategoryRepository())
+
+	err := s.CreateCategory(context.Background(), &models.Category{UserID: 1, Name: " "})
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+	categories, err := s.GetCategoriesByUser(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 0 {
+		t.Errorf("got %d categories, want none", len(categories))
+	}
+}
+
+func TestCategoriesArePerUser(t *testing.T) {
+	s := NewCategoryService(repository.NewMemoryCategoryRepository())
+	ctx := context.Background()
+	mine := &models.Category{UserID: 1, Name: "Work"}
+	if err := s.CreateCategory(ctx, mine); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateCategory(ctx, &models.Category{UserID: 2, Name: "Theirs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetCategoryById(ctx, mine.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Work" {
+		t.Errorf("name = %q, want Work", got.Name)
+	}
+	if _, err := s.GetCategoryById(ctx, mine.ID, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other user's get err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteCategory(ctx, mine.ID, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other user's delete err = %v, want ErrNotFound", err)
+	}
+
+	categories, err := s.GetCategoriesByUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 1 || categories[0].ID != mine.ID {
+		t.Errorf("user 1 lists %v, want only category %d", categories, mine.ID)
+	}
+}
+
+func TestDeleteCategory(t *testing.T) {
+	s := NewCategoryService(repository.NewMemoryCategoryRepository())
+	ctx := context.Background()
+	category := &models.Category{UserID: 1, Name: "Errands"}
+	if err := s.CreateCategory(ctx, category); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteCategory(ctx, category.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetCategoryById(ctx, category.ID, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound after delete", err)
+	}
+	if err := s.DeleteCategory(ctx, category.ID, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+// reauthWindow is how recently a user without a password must have logged
+// in through their identity provider to confirm a sensitive change.
+const reauthWindow = 10 * time.Minute
+
+// AuditConfirmationFailed records a wrong password given to confirm a
+// change to the account.
+const AuditConfirmationFailed = "user.confirmation_failed"
+
+var ErrReauthenticationRequired = fmt.Errorf("log in again through your identity provider to confirm this change: %w", ErrForbidden)
+
+// CredentialChecker makes sure the account owner, and not just whoever
+// holds one of their access tokens, is behind a change that could hand the
+// account to someone else. Wrong passwords count against the login limits,
+// so a stolen access token is no way around them.
+type CredentialChecker struct {
+	TOTP     *TOTPService
+	Sessions *repository.SessionRepository
+	Audit    *repository.AuditRepository
+	Limits   LoginLimits
+}
+
+func NewCredentialChecker(totp *TOTPService, sessions *repository.SessionRepository, audit *repository.AuditRepository, limits LoginLimits) *CredentialChecker {
+	return &CredentialChecker{TOTP: totp, Sessions: sessions, Audit: audit, Limits: limits}
+}
+
+// Confirm asks users with a password for it again, and for their second
+// factor when they have one. Users who only log in through an identity
+// provider confirm with their second factor or, without one, by having
+// logged in within reauthWindow. passwordField names the password in
+// validation errors.
+func (c *CredentialChecker) Confirm(ctx context.Context, actor Actor, user *models.User, passwordField, password, code string) error {
+	mfa, err := c.TOTP.Enabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if user.HasPassword() {
+		if err := c.CheckPassword(ctx, actor, user, passwordField, password); err != nil {
+			return err
+		}
+	} else if !mfa {
+		return c.checkFreshLogin(ctx, actor)
+	}
+	if !mfa {
+		return nil
+	}
+	if code == "" {
+		return NewValidationError("code", "authentication code is required")
+	}
+	return c.TOTP.verifyEnabled(ctx, actor, code)
+}
+
+// CheckPassword compares password with the user's under the login limits.
+// A wrong one counts as a failed login and is recorded in the audit log.
+func (c *CredentialChecker) CheckPassword(ctx context.Context, actor Actor, user *models.User, passwordField, password string) error {
+	if err := c.Limits.check(user.Username, actor.IP); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err == nil {
+		return nil
+	}
+
+	var metadata map[string]any
+	if c.Limits.fail(user.Username, actor.IP) {
+		metadata = map[string]any{"locked": true}
+	}
+	if err := recordAudit(ctx, c.Audit, actor, AuditConfirmationFailed, user.ID, metadata); err != nil {
+		log.Printf("record failed confirmation: %v", err)
+	}
+	return NewValidationError(passwordField, "password is incorrect")
+}
+
+func (c *CredentialChecker) checkFreshLogin(ctx context.Context, actor Actor) error {
+	if actor.SessionID == "" {
+		return ErrReauthenticationRequired
+	}
+	fresh, err := c.Sessions.CreatedWithin(ctx, actor.SessionID, actor.UserID, reauthWindow)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
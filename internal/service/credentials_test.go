@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+func TestWrongConfirmationPasswordsAreThrottled(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	auth := newTestAuthService(db)
+	checker := NewCredentialChecker(auth.TOTP, auth.Sessions, auth.Audit, auth.Limits)
+	user := createTestUser(t, auth.Repo, "alice", "alice@example.com", true)
+	actor := Actor{UserID: user.ID, IP: "192.0.2.1"}
+
+	// testLoginLimits lets three failures go free; the fourth makes callers
+	// wait.
+	for i := range 4 {
+		err := checker.CheckPassword(ctx, actor, user, "password", "wrong")
+		if got := validationFields(err); len(got) != 1 || got[0] != "password" {
+			t.Fatalf("attempt %d: err = %v, want a password validation error", i+1, err)
+		}
+	}
+	var rateLimited *RateLimitError
+	if err := checker.CheckPassword(ctx, actor, user, "password", "wrong"); !errors.As(err, &rateLimited) {
+		t.Errorf("err = %v, want a RateLimitError", err)
+	}
+
+	entries, err := repository.NewAuditRepository(db).List(ctx, AuditConfirmationFailed, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("%d failed confirmations recorded, want 4", len(entries))
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/jwtkeys"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/migrate"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/throttle"
+	"github.com/MuhammadrasulGasanov/go-tasks/migrations"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL, migrates it and
+// empties it. Tests using it skip when the variable is not set. The database
+// is wiped, so point it at a scratch database only.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Everything else belongs to a user and goes with the users.
+	if _, err := db.ExecContext(ctx, `TRUNCATE users, audit_log RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testLoginLimits() LoginLimits {
+	cfg := throttle.Config{FreeFailures: 3, BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 10, LockoutDuration: time.Minute, Window: time.Hour}
+	return LoginLimits{Users: throttle.New(cfg), IPs: throttle.New(cfg)}
+}
+
+func newTestAuthService(db *sql.DB) *AuthService {
+	users := repository.NewUserRepository(db)
+	limits := testLoginLimits()
+	return NewAuthService(
+		users,
+		repository.NewRefreshTokenRepository(db),
+		repository.NewSessionRepository(db),
+		NewTOTPService(users, repository.NewTOTPRepository(db), "go-tasks", limits),
+		repository.NewAuditRepository(db),
+		limits,
+		jwtkeys.NewHMAC("test-secret"),
+		15*time.Minute,
+		24*time.Hour,
+	)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/mailer"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const maxEmailLength = 254
+
+var ErrInvalidVerificationToken = NewValidationError("token", "invalid or expired verification token")
+
+type EmailService struct {
+	Users       *repository.UserRepository
+	Tokens      *repository.EmailVerificationRepository
+	Credentials *CredentialChecker
+	Mailer      mailer.Mailer
+	TTL         time.Duration
+	// VerifyURL is the page that confirms the address. The token is appended
+	// as the "token" query parameter.
+	VerifyURL string
+}
+
+func NewEmailService(users *repository.UserRepository, tokens *repository.EmailVerificationRepository, credentials *CredentialChecker, m mailer.Mailer, ttl time.Duration, verifyURL string) *EmailService {
+	return &EmailService{Users: users, Tokens: tokens, Credentials: credentials, Mailer: m, TTL: ttl, VerifyURL: verifyURL}
+}
+
+// normalizeEmail checks that s is a bare address such as "a@example.com"
+// and returns it trimmed.
+func normalizeEmail(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > maxEmailLength {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "", false
+	}
+	return s, true
+}
+
+// ChangeEmail sets a new, unverified address and sends a verification mail
+// to it. Since password resets go to this address, the owner has to confirm
+// the change as CredentialChecker.Confirm describes, and the previous
+// verified address is told about it.
+func (s *EmailService) ChangeEmail(ctx context.Context, actor Actor, email, password, code string) (*models.User, error) {
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return nil, NewValidationError("email", "must be a valid email address")
+	}
+	user, err := s.Users.GetByID(actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.Credentials.Confirm(ctx, actor, user, "current_password", password, code); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(user.Email, email) {
+		return user, nil
+	}
+
+	previous, previousVerified := user.Email, user.EmailVerified()
+	if err := s.Users.SetEmail(user.ID, email); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, fmt.Errorf("email already in use: %w", ErrConflict)
+		}
+		return nil, mapRepoError(err)
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+
+	if err := s.SendVerification(ctx, user); err != nil {
+		log.Printf("send verification mail to user %d: %v", user.ID, err)
+	}
+	if previousVerified {
+		msg := mailer.Message{
+			To:      previous,
+			Subject: "Your go-tasks email address was changed",
+			Body: fmt.Sprintf("The email address of your go-tasks account %s was changed to %s.\n\n"+
+				"If you did not make this change, sign in, change your password and set your address back.\n", user.Username, email),
+		}
+		if err := s.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("send email change notice to user %d: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// ResendVerification mails a fresh verification token for the user's
+// current address.
+func (s *EmailService) ResendVerification(ctx context.Context, userID int) error {
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+	if user.Email == "" {
+		return NewValidationError("email", "no email address set")
+	}
+	if user.EmailVerified() {
+		return fmt.Errorf("email already verified: %w", ErrConflict)
+	}
+	return s.SendVerification(ctx, user)
+}
+
+func (s *EmailService) SendVerification(ctx context.Context, user *models.User) error {
+	raw, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	token := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.TTL),
+	}
+	if err := s.Tokens.Create(ctx, token); err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your go-tasks email address",
+		Body:    tokenMailBody("Please confirm that this address belongs to your go-tasks account.", s.VerifyURL, raw, s.TTL),
+	})
+}
+
+// Verify confirms the address a token was issued for. It fails when the
+// user changed their email since.
+func (s *EmailService) Verify(ctx context.Context, rawToken string) error {
+	token, err := s.Tokens.Consume(ctx, hashToken(rawToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	err = s.Users.MarkEmailVerified(token.UserID, token.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	return err
+}
+
+func (s *EmailService) IsEmailVerified(ctx context.Context, userID int) (bool, error) {
+	user, err := s.Users.GetByID(userID)
+	if err != nil || user == nil {
+		return false, err
+	}
+	return user.EmailVerified(), nil
+}
+
+// tokenMailBody renders a mail asking the user to follow a link, or to use
+// the bare token when no link is configured.
+func tokenMailBody(intro, link, token string, ttl time.Duration) string {
+	body := intro + "\n\n"
+	if link != "" {
+		sep := "?"
+		if strings.Contains(link, "?") {
+			sep = "&"
+		}
+		body += fmt.Sprintf("Open %s%stoken=%s to continue.\n\n", link, sep, token)
+	} else {
+		body += fmt.Sprintf("Use this token to continue: %s\n\n", token)
+	}
+	body += fmt.Sprintf("The link expires in %s. If you did not ask for it, ignore this message.\n", ttl)
+	return body
+}
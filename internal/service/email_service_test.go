@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/mailer"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+var mailTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// mailedToken returns the token of the last mail sent to the address.
+func mailedToken(t *testing.T, m *mailer.MemoryMailer, to string) string {
+	t.Helper()
+	msg, ok := m.Last(to)
+	if !ok {
+		t.Fatalf("no mail sent to %s", to)
+	}
+	match := mailTokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("no token in mail to %s:\n%s", to, msg.Body)
+	}
+	return match[1]
+}
+
+func TestRegisterAndVerifyEmail(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	mail := mailer.NewMemoryMailer()
+	users := repository.NewUserRepository(db)
+	emails := NewEmailService(users, repository.NewEmailVerificationRepository(db), nil, mail, time.Hour, "https://tasks.example.com/email/verify")
+	policy, err := NewPasswordPolicy(8, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewUserService(users, policy, emails)
+
+	user, err := s.Register(ctx, "dora", "dora@example.com", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified, _ := emails.IsEmailVerified(ctx, user.ID); verified {
+		t.Fatal("address verified before the link was followed")
+	}
+
+	token := mailedToken(t, mail, "dora@example.com")
+	if err := emails.Verify(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	verified, err := emails.IsEmailVerified(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("address not verified after following the link")
+	}
+
+	if err := emails.Verify(ctx, token); !errors.Is(err, ErrValidation) {
+		t.Errorf("reusing the token: err = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+var (
+	ErrNotFound           = errors.New("resource not found")
+	ErrConflict           = errors.New("resource already exists")
+	ErrValidation         = errors.New("validation failed")
+	ErrPreconditionFailed = errors.New("resource has been modified")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrTooManyRequests    = errors.New("too many requests")
+)
+
+// RateLimitError tells the client when it may try again. It matches
+// ErrTooManyRequests with errors.Is.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "too many attempts, try again later"
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrTooManyRequests
+}
+
+// ValidationError collects problems with individual input fields. It matches
+// ErrValidation with errors.Is.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func NewValidationError(field, message string) *ValidationError {
+	e := &ValidationError{}
+	e.Add(field, message)
+	return e
+}
+
+func (e *ValidationError) Add(field, message string) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = message
+	}
+}
+
+// Err returns nil when no field was reported.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = e.Fields[f]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// mapRepoError translates storage errors into the errors of this package.
+func mapRepoError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return ErrPreconditionFailed
+	case errors.Is(err, repository.ErrDuplicate):
+		return ErrConflict
+	case errors.Is(err, repository.ErrParentCycle):
+		return NewValidationError("parent_id", "parent task cannot be a subtask of this task")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const (
+	AuditIdentityLinked      = "user.identity_linked"
+	AuditIdentityProvisioned = "user.identity_provisioned"
+)
+
+// TokenTypeOIDCState marks the token that carries an OIDC login's state,
+// nonce and PKCE verifier from the redirect to the callback.
+const TokenTypeOIDCState = "oidc_state"
+
+// oidcStateTTL is how long a user has to log in at the identity provider.
+const oidcStateTTL = 10 * time.Minute
+
+// maxGeneratedUsernameLength leaves room within the 50 characters of the
+// username column for a suffix that makes the name unique.
+const maxGeneratedUsernameLength = 40
+
+var (
+	ErrInvalidOIDCState = fmt.Errorf("invalid or expired login state: %w", ErrUnauthorized)
+	ErrOIDCLoginFailed  = fmt.Errorf("identity provider login failed: %w", ErrUnauthorized)
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// OIDCService logs users in through an external OpenID Connect provider
+// using the authorization code flow with PKCE. Unknown users are created on
+// first login, or linked to an existing account with the same verified
+// email address.
+type OIDCService struct {
+	Issuer     string
+	OAuth      *oauth2.Config
+	Verifier   *oidc.IDTokenVerifier
+	Users      *repository.UserRepository
+	Identities *repository.IdentityRepository
+	Audit      *repository.AuditRepository
+	Auth       *AuthService
+}
+
+// NewOIDCService discovers the provider's endpoints and keys from issuer.
+func NewOIDCService(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string, users *repository.UserRepository, identities *repository.IdentityRepository, audit *repository.AuditRepository, auth *AuthService) (*OIDCService, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCService{
+		Issuer: issuer,
+		OAuth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		Verifier:   provider.Verifier(&oidc.Config{ClientID: clientID}),
+		Users:      users,
+		Identities: identities,
+		Audit:      audit,
+		Auth:       auth,
+	}, nil
+}
+
+// oidcClaims are the ID token claims used to provision accounts.
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// emailVerified accepts the boolean the spec requires as well as the string
+// some providers send instead.
+func (c oidcClaims) emailVerified() bool {
+	return c.EmailVerified == true || c.EmailVerified == "true"
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to redirect the
+// user to and a state token that must come back with the callback, which
+// holds the state, the nonce and the PKCE verifier.
+func (s *OIDCService) AuthCodeURL() (string, string, error) {
+	state, err := randomID()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomID()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	stateToken, err := s.Auth.Keys.Sign(jwt.MapClaims{
+		"typ":      TokenTypeOIDCState,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"iat":      now.Unix(),
+		"exp":      now.Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	url := s.OAuth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, stateToken, nil
+}
+
+// Callback finishes a login started with AuthCodeURL: it redeems the code,
+// verifies the ID token and logs in the user it names.
+func (s *OIDCService) Callback(ctx context.Context, stateToken, state, code string, client ClientInfo) (*LoginResult, error) {
+	claims := jwt.MapClaims{}
+	token, err := s.Auth.Keys.Parse(stateToken, claims)
+	if err != nil || !token.Valid || claims["typ"] != TokenTypeOIDCState {
+		return nil, ErrInvalidOIDCState
+	}
+	wantState, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if wantState == "" || subtle.ConstantTimeCompare([]byte(wantState), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	oauthToken, err := s.OAuth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		log.Printf("oidc code exchange: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		log.Printf("oidc token response has no id_token")
+		return nil, ErrOIDCLoginFailed
+	}
+	idToken, err := s.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("oidc id token: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrOIDCLoginFailed
+	}
+	var idClaims oidcClaims
+	if err := idToken.Claims(&idClaims); err != nil {
+		log.Printf("oidc id token claims: %v", err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, idToken.Subject, idClaims, client)
+	if err != nil {
+		return nil, err
+	}
+	return s.Auth.LoginAuthenticated(ctx, user, client)
+}
+
+// resolveUser finds the user linked to the external account, links it to
+// the account with the same verified email, or creates a new account.
+func (s *OIDCService) resolveUser(ctx context.Context, subject string, claims oidcClaims, client ClientInfo) (*models.User, error) {
+	identity, err := s.Identities.Get(ctx, s.Issuer, subject)
+	if err == nil {
+		user, err := s.Users.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrNotFound
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	email, hasEmail := normalizeEmail(claims.Email)
+	if hasEmail {
+		existing, err := s.Users.GetByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			// Linking on an address either side has not verified would
+			// let whoever controls the other account take this one over.
+			if !claims.emailVerified() || !existing.EmailVerified() {
+				return nil, fmt.Errorf("an account with this email already exists; log in with your password first: %w", ErrConflict)
+			}
+			if err := s.link(ctx, existing, subject, email); err != nil {
+				return nil, err
+			}
+			return existing, s.record(ctx, existing.ID, client, AuditIdentityLinked)
+		}
+	} else {
+		email = ""
+	}
+
+	user, err := s.provision(ctx, subject, claims, email)
+	if err != nil {
+		return nil, err
+	}
+	return user, s.record(ctx, user.ID, client, AuditIdentityProvisioned)
+}
+
+// provision creates an account without a password, linked to the external
+// account. Its owner logs in through the provider, or sets a password after
+// confirming with a fresh login.
+func (s *OIDCService) provision(ctx context.Context, subject string, claims oidcClaims, email string) (*models.User, error) {
+	base := generatedUsername(claims.PreferredUsername, email)
+	username := base
+	for attempt := 0; ; attempt++ {
+		existing, err := s.Users.GetByUsername(username)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			break
+		}
+		if attempt == 5 {
+			return nil, fmt.Errorf("could not find a free username for %q: %w", base, ErrConflict)
+		}
+		suffix, err := randomID()
+		if err != nil {
+			return nil, err
+		}
+		username = base + "-" + suffix[:6]
+	}
+
+	user := &models.User{Username: username, Email: email}
+	if email != "" && claims.emailVerified() {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	identity := &models.UserIdentity{Issuer: s.Issuer, Subject: subject, Email: email}
+	if err := s.Identities.CreateWithUser(ctx, user, identity); err != nil {
+		return nil, mapRepoError(err)
+	}
+	return user, nil
+}
+
+func (s *OIDCService) link(ctx context.Context, user *models.User, subject, email string) error {
+	return mapRepoError(s.Identities.Create(ctx, &models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  s.Issuer,
+		Subject: subject,
+		Email:   email,
+	}))
+}
+
+func (s *OIDCService) record(ctx context.Context, userID int, client ClientInfo, action string) error {
+	return recordAudit(ctx, s.Audit, Actor{UserID: userID, IP: client.IP}, action, userID, map[string]any{"issuer": s.Issuer})
+}
+
+// generatedUsername derives a username from the provider's preferred
+// username, falling back to the local part of the email address.
+func generatedUsername(preferred, email string) string {
+	name := preferred
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	name = strings.Trim(usernameUnsafeChars.ReplaceAllString(name, "-"), "-")
+	if len(name) > maxGeneratedUsernameLength {
+		name = name[:maxGeneratedUsernameLength]
+	}
+	if name == "" {
+		name = "user"
+	}
+	return name
+}
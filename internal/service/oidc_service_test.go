@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/jwtkeys"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const testClientID = "go-tasks"
+
+// stubProvider is an OpenID Connect provider serving discovery, its keys and
+// a token endpoint. It answers every code with an ID token for Claims,
+// provided the PKCE verifier matches the challenge it was given.
+type stubProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// Challenge is the PKCE challenge of the authorization request, and
+	// Nonce the nonce to put in the ID token.
+	Challenge string
+	Nonce     string
+	Claims    jwt.MapClaims
+	// Verifier is the code_verifier the last token request sent.
+	Verifier string
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &stubProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Verifier = r.PostFormValue("code_verifier")
+	sum := sha256.Sum256([]byte(p.Verifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != p.Challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": p.Nonce,
+	}
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"access_token": "stub-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// newTestOIDCService logs in through p with auth's repositories.
+func newTestOIDCService(t *testing.T, p *stubProvider, auth *AuthService) *OIDCService {
+	t.Helper()
+	s, err := NewOIDCService(context.Background(), p.URL, testClientID, "secret", "http://localhost/oidc/callback", []string{"openid", "email"},
+		auth.Repo, repository.NewIdentityRepository(auth.Repo.DB), auth.Audit, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// keysOnlyAuth is enough for the checks that come before any user lookup.
+func keysOnlyAuth() *AuthService {
+	return &AuthService{Repo: &repository.UserRepository{}, Keys: jwtkeys.NewHMAC("test-secret")}
+}
+
+// startLogin runs AuthCodeURL and hands the request's PKCE challenge and
+// nonce to the provider, the way the browser redirect would. It returns the
+// state token and the state.
+func startLogin(t *testing.T, s *OIDCService, p *stubProvider) (string, string) {
+	t.Helper()
+	authURL, stateToken, err := s.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	p.mu.Lock()
+	p.Challenge = q.Get("code_challenge")
+	p.Nonce = q.Get("nonce")
+	p.mu.Unlock()
+	return stateToken, q.Get("state")
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	p := newStubProvider(t)
+	s := newTestOIDCService(t, p, keysOnlyAuth())
+	stateToken, _ := startLogin(t, s, p)
+
+	_, err := s.Callback(context.Background(), stateToken, "forged-state", "code", ClientInfo{})
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want ErrInvalidOIDCState", err)
+	}
+	if p.Verifier != "" {
+		t.Error("the code was redeemed despite the state mismatch")
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	p := newStubProvider(t)
+	s := newTestOIDCService(t, p, keysOnlyAuth())
+	stateToken, state := startLogin(t, s, p)
+	p.Nonce = "replayed-nonce"
+	p.Claims = jwt.MapClaims{"sub": "alice"}
+
+	_, err := s.Callback(context.Background(), stateToken, state, "code", ClientInfo{})
+	if !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("err = %v, want ErrOIDCLoginFailed", err)
+	}
+}
+
+func TestOIDCCallbackForwardsPKCEVerifier(t *testing.T) {
+	p := newStubProvider(t)
+	s := newTestOIDCService(t, p, keysOnlyAuth())
+
+	// A code bound to someone else's challenge must not be redeemable with
+	// the verifier of this login.
+	stateToken, state := startLogin(t, s, p)
+	p.Challenge = "challenge-of-another-login"
+	_, err := s.Callback(context.Background(), stateToken, state, "code", ClientInfo{})
+	if !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("err = %v, want ErrOIDCLoginFailed", err)
+	}
+	if p.Verifier == "" {
+		t.Fatal("the token request carried no code_verifier")
+	}
+
+	// The verifier sent is the one kept in this login's state token.
+	stateToken, state = startLogin(t, s, p)
+	p.Nonce = "stop-before-user-lookup"
+	_, err = s.Callback(context.Background(), stateToken, state, "code", ClientInfo{})
+	if !errors.Is(err, ErrOIDCLoginFailed) {
+		t.Fatalf("err = %v, want ErrOIDCLoginFailed", err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := s.Auth.Keys.Parse(stateToken, claims); err != nil {
+		t.Fatal(err)
+	}
+	if p.Verifier != claims["verifier"] {
+		t.Errorf("token request verifier = %q, want the one from the state token", p.Verifier)
+	}
+}
+
+func TestOIDCCallbackProvisionsNewUser(t *testing.T) {
+	auth := newTestAuthService(openTestDB(t))
+	p := newStubProvider(t)
+	s := newTestOIDCService(t, p, auth)
+	ctx := context.Background()
+
+	stateToken, state := startLogin(t, s, p)
+	p.Claims = jwt.MapClaims{"sub": "alice-sub", "email": "Alice@Example.com", "email_verified": true, "preferred_username": "alice"}
+	result, err := s.Callback(ctx, stateToken, state, "code", ClientInfo{IP: "203.0.113.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Tokens == nil {
+		t.Fatal("no tokens issued")
+	}
+
+	user, err := auth.Repo.GetByUsername("alice")
+	if err != nil || user == nil {
+		t.Fatalf("provisioned user not found: %v", err)
+	}
+	if user.ID != result.User.ID {
+		t.Errorf("logged in user %d, provisioned %d", result.User.ID, user.ID)
+	}
+	if user.HasPassword() {
+		t.Error("provisioned user has a password")
+	}
+	if user.Email != "alice@example.com" || !user.EmailVerified() {
+		t.Errorf("email = %q verified = %v, want verified alice@example.com", user.Email, user.EmailVerified())
+	}
+	identity, err := s.Identities.Get(ctx, p.URL, "alice-sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != user.ID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, user.ID)
+	}
+
+	// The next login finds the linked account instead of creating another.
+	stateToken, state = startLogin(t, s, p)
+	again, err := s.Callback(ctx, stateToken, state, "code", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.User.ID != user.ID {
+		t.Errorf("second login got user %d, want %d", again.User.ID, user.ID)
+	}
+	if n, _ := auth.Repo.Count(); n != 1 {
+		t.Errorf("%d users exist, want 1", n)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	auth := newTestAuthService(openTestDB(t))
+	p := newStubProvider(t)
+	s := newTestOIDCService(t, p, auth)
+	ctx := context.Background()
+
+	local := createTestUser(t, auth.Repo, "bob", "bob@example.com", true)
+
+	stateToken, state := startLogin(t, s, p)
+	p.Claims = jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true}
+	result, err := s.Callback(ctx, stateToken, state, "code", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != local.ID {
+		t.Errorf("logged in as user %d, want the existing user %d", result.User.ID, local.ID)
+	}
+	identity, err := s.Identities.Get(ctx, p.URL, "bob-sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != local.ID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, local.ID)
+	}
+}
+
+func TestOIDCCallbackRefusesUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name             string
+		localVerified    bool
+		providerVerified bool
+	}{
+		{"local email unverified", false, true},
+		{"provider email unverified", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newTestAuthService(openTestDB(t))
+			p := newStubProvider(t)
+			s := newTestOIDCService(t, p, auth)
+			ctx := context.Background()
+
+			createTestUser(t, auth.Repo, "carol", "carol@example.com", tt.localVerified)
+
+			stateToken, state := startLogin(t, s, p)
+			p.Claims = jwt.MapClaims{"sub": "carol-sub", "email": "carol@example.com", "email_verified": tt.providerVerified}
+			_, err := s.Callback(ctx, stateToken, state, "code", ClientInfo{})
+			if !errors.Is(err, ErrConflict) {
+				t.Fatalf("err = %v, want ErrConflict", err)
+			}
+			if _, err := s.Identities.Get(ctx, p.URL, "carol-sub"); !errors.Is(err, repository.ErrNotFound) {
+				t.Errorf("identity lookup err = %v, want ErrNotFound", err)
+			}
+			if n, _ := auth.Repo.Count(); n != 1 {
+				t.Errorf("%d users exist, want 1", n)
+			}
+		})
+	}
+}
+
+func createTestUser(t *testing.T, users *repository.UserRepository, username, email string, verified bool) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: email, PasswordHash: "$2a$10$invalidinvalidinvalidinvalidinvalidinvalidinvalidinva"}
+	if err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err := users.MarkEmailVerified(user.ID, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user
+}
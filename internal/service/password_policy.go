@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is the most bcrypt looks at; longer passwords would be
+// silently truncated.
+const maxPasswordBytes = 72
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	MinLength int
+	// breached holds upper case hex SHA-1 hashes of known leaked passwords.
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy builds a policy and, when breachList is set, loads the
+// leaked passwords from that file. Each line holds either a password or its
+// SHA-1 hash as published by Have I Been Pwned ("HASH" or "HASH:count").
+func NewPasswordPolicy(minLength int, breachList string) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{MinLength: minLength, breached: map[string]struct{}{}}
+	if breachList == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(breachList)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	return p, scanner.Err()
+}
+
+// Validate reports on field in verr when password is not acceptable for the
+// user.
+func (p *PasswordPolicy) Validate(verr *ValidationError, field, password, username string) {
+	switch {
+	case password == "":
+		verr.Add(field, "password is required")
+	case utf8.RuneCountInString(password) < p.MinLength:
+		verr.Add(field, fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	case len(password) > maxPasswordBytes:
+		verr.Add(field, fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes))
+	case username != "" && strings.EqualFold(password, username):
+		verr.Add(field, "password must not match the username")
+	case p.isBreached(password):
+		verr.Add(field, "password appears in a list of leaked passwords")
+	}
+}
+
+func (p *PasswordPolicy) isBreached(password string) bool {
+	_, ok := p.breached[sha1Hex(password)]
+	return ok
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/mailer"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const (
+	AuditPasswordChanged        = "user.password_changed"
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditPasswordReset          = "user.password_reset"
+)
+
+var ErrInvalidResetToken = NewValidationError("token", "invalid or expired reset token")
+
+type PasswordService struct {
+	Users         *repository.UserRepository
+	ResetTokens   *repository.PasswordResetRepository
+	RefreshTokens *repository.RefreshTokenRepository
+	APITokens     *repository.APITokenRepository
+	Audit         *repository.AuditRepository
+	Credentials   *CredentialChecker
+	Mailer        mailer.Mailer
+	Policy        *PasswordPolicy
+	ResetTTL      time.Duration
+	// ResetURL is the page users open to pick a new password. The token is
+	// appended as the "token" query parameter.
+	ResetURL string
+}
+
+func NewPasswordService(users *repository.UserRepository, resetTokens *repository.PasswordResetRepository, refreshTokens *repository.RefreshTokenRepository, apiTokens *repository.APITokenRepository, audit *repository.AuditRepository, credentials *CredentialChecker, m mailer.Mailer, policy *PasswordPolicy, resetTTL time.Duration, resetURL string) *PasswordService {
+	return &PasswordService{
+		Users:         users,
+		ResetTokens:   resetTokens,
+		RefreshTokens: refreshTokens,
+		APITokens:     apiTokens,
+		Audit:         audit,
+		Credentials:   credentials,
+		Mailer:        m,
+		Policy:        policy,
+		ResetTTL:      resetTTL,
+		ResetURL:      resetURL,
+	}
+}
+
+// ChangePassword replaces the password after checking the current one,
+// signs the user out of every session and revokes their API tokens. Users without a password, who log in
+// through an identity provider, set their first one by confirming with code
+// as CredentialChecker.Confirm describes.
+func (s *PasswordService) ChangePassword(ctx context.Context, actor Actor, current, next, code string) error {
+	user, err := s.Users.GetByID(actor.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+
+	if !user.HasPassword() {
+		if err := s.Credentials.Confirm(ctx, actor, user, "current_password", "", code); err != nil {
+			return err
+		}
+	} else if err := s.Credentials.CheckPassword(ctx, actor, user, "current_password", current); err != nil {
+		return err
+	}
+	verr := &ValidationError{}
+	if user.HasPassword() && next == current {
+		verr.Add("new_password", "new password must differ from the current one")
+	}
+	s.Policy.Validate(verr, "new_password", next, user.Username)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	if err := s.setPassword(ctx, user.ID, next); err != nil {
+		return err
+	}
+	return recordAudit(ctx, s.Audit, actor, AuditPasswordChanged, user.ID, nil)
+}
+
+// RequestReset mails a single-use reset token to the verified address of
+// the user identified by username or email. Unknown and disabled accounts,
+// and those without a verified address, are ignored without an error so the
+// endpoint does not reveal which accounts exist.
+func (s *PasswordService) RequestReset(ctx context.Context, login, ip string) error {
+	user, err := s.Users.GetByUsername(login)
+	if err == nil && user == nil {
+		user, err = s.Users.GetByEmail(login)
+	}
+	if err != nil {
+		return err
+	}
+	if user == nil || user.DisabledAt != nil || !user.EmailVerified() {
+		return nil
+	}
+
+	raw, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+	token := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.ResetTTL),
+	}
+	if err := s.ResetTokens.Create(ctx, token); err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your go-tasks password",
+		Body:    tokenMailBody("Someone asked to reset the password of your go-tasks account.", s.ResetURL, raw, s.ResetTTL),
+	}
+	if err := s.Mailer.Send(ctx, msg); err != nil {
+		// The caller always gets the same answer; the failure is only logged.
+		log.Printf("send password reset mail to user %d: %v", user.ID, err)
+	}
+	return recordAudit(ctx, s.Audit, Actor{UserID: user.ID, IP: ip}, AuditPasswordResetRequested, user.ID, nil)
+}
+
+// ResetPassword sets a new password using a token from RequestReset. The
+// token and any other outstanding ones of the user stop working, every
+// session is signed out and the user's API tokens are revoked.
+func (s *PasswordService) ResetPassword(ctx context.Context, rawToken, next, ip string) error {
+	token, err := s.ResetTokens.GetValid(ctx, hashToken(rawToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	user, err := s.Users.GetByID(token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.DisabledAt != nil {
+		return ErrInvalidResetToken
+	}
+	verr := &ValidationError{}
+	s.Policy.Validate(verr, "new_password", next, user.Username)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	// Consume again checks the token atomically, so a concurrent reset with
+	// the same token fails here.
+	if _, err := s.ResetTokens.Consume(ctx, token.TokenHash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if err := s.setPassword(ctx, user.ID, next); err != nil {
+		return err
+	}
+	return recordAudit(ctx, s.Audit, Actor{UserID: user.ID, IP: ip}, AuditPasswordReset, user.ID, nil)
+}
+
+// setPassword stores the new password and revokes every credential issued
+// under the old one, so a new password locks out whoever learned the old.
+func (s *PasswordService) setPassword(ctx context.Context, userID int, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.Users.UpdatePassword(userID, string(hashed)); err != nil {
+		return mapRepoError(err)
+	}
+	if err := s.RefreshTokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.APITokens.RevokeAllForUser(ctx, userID)
+}
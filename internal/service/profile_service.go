@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const maxDisplayNameLength = 100
+
+// localePattern accepts BCP 47 tags of the common language[-Script][-REGION]
+// form, e.g. "en", "pt-BR" or "zh-Hant-TW".
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+var weekStarts = map[string]bool{"monday": true, "sunday": true, "saturday": true}
+
+type ProfileService struct {
+	Users       *repository.UserRepository
+	Preferences *repository.PreferencesRepository
+	Categories  repository.CategoryRepository
+}
+
+func NewProfileService(users *repository.UserRepository, prefs *repository.PreferencesRepository, categories repository.CategoryRepository) *ProfileService {
+	return &ProfileService{Users: users, Preferences: prefs, Categories: categories}
+}
+
+func (s *ProfileService) GetProfile(ctx context.Context, userID int) (*models.Profile, error) {
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	prefs, err := s.Preferences.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Profile{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		EmailVerified:   user.EmailVerified(),
+		Role:            user.Role,
+		CreatedAt:       user.CreatedAt,
+		UserPreferences: *prefs,
+	}, nil
+}
+
+// UserPreferences returns the settings other features honour, such as the
+// time zone due dates are read in.
+func (s *ProfileService) UserPreferences(ctx context.Context, userID int) (*models.UserPreferences, error) {
+	return s.Preferences.Get(ctx, userID)
+}
+
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID int, patch models.PreferencesPatch) (*models.Profile, error) {
+	prefs, err := s.Preferences.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	patch.Apply(prefs)
+
+	if prefs.DisplayName != nil {
+		name := strings.TrimSpace(*prefs.DisplayName)
+		prefs.DisplayName = &name
+		if name == "" {
+			prefs.DisplayName = nil
+		}
+	}
+
+	verr := &ValidationError{}
+	if prefs.DisplayName != nil && utf8.RuneCountInString(*prefs.DisplayName) > maxDisplayNameLength {
+		verr.Add("display_name", "display name is too long")
+	}
+	if _, err := time.LoadLocation(prefs.Timezone); err != nil || prefs.Timezone == "Local" {
+		verr.Add("timezone", "must be an IANA time zone such as Europe/Berlin")
+	}
+	if !localePattern.MatchString(prefs.Locale) {
+		verr.Add("locale", "must be a language tag such as en or pt-BR")
+	}
+	if !weekStarts[prefs.WeekStart] {
+		verr.Add("week_start", "must be monday, sunday or saturday")
+	}
+	if patch.DefaultCategoryID.Set && prefs.DefaultCategoryID != nil {
+		_, err := s.Categories.GetByID(ctx, *prefs.DefaultCategoryID, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			verr.Add("default_category_id", "category does not exist")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.Preferences.Save(ctx, userID, prefs); err != nil {
+		return nil, err
+	}
+	return s.GetProfile(ctx, userID)
+}
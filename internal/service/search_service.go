@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+type SearchService struct {
+	Tasks      repository.TaskRepository
+	Categories repository.CategoryRepository
+}
+
+func NewSearchService(tasks repository.TaskRepository, categories repository.CategoryRepository) *SearchService {
+	return &SearchService{Tasks: tasks, Categories: categories}
+}
+
+type SearchResults struct {
+	Tasks      []*models.TaskSearchResult     `json:"tasks"`
+	Categories []*models.CategorySearchResult `json:"categories"`
+}
+
+func (s *SearchService) Search(ctx context.Context, userID int, query string, limit int) (*SearchResults, error) {
+	tasks, err := s.Tasks.Search(ctx, userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.Categories.Search(ctx, userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &SearchResults{
+		Tasks:      tasks,
+		Categories: categories,
+	}
+	if results.Tasks == nil {
+		results.Tasks = []*models.TaskSearchResult{}
+	}
+	if results.Categories == nil {
+		results.Categories = []*models.CategorySearchResult{}
+	}
+	return results, nil
+}
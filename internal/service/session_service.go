@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+type SessionService struct {
+	Repo *repository.SessionRepository
+}
+
+func NewSessionService(repo *repository.SessionRepository) *SessionService {
+	return &SessionService{Repo: repo}
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	sessions, err := s.Repo.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the device out. Its refresh token stops working at
+// once and so do access tokens issued for it.
+func (s *SessionService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	return mapRepoError(s.Repo.Revoke(ctx, userID, sessionID))
+}
+
+// SessionActive reports whether an access token issued for the session may
+// still be used, and records that the session was seen.
+func (s *SessionService) SessionActive(ctx context.Context, sessionID string, userID int) (bool, error) {
+	session, err := s.Repo.Get(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.UserID != userID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return false, nil
+	}
+	if err := s.Repo.TouchLastSeen(ctx, sessionID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
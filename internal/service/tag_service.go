@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+// DefaultTagColor is given to tags created without a color, including the
+// ones created by tagging a task with a new name.
+const DefaultTagColor = "#9e9e9e"
+
+const (
+	maxTagNameLength = 50
+	maxTagsPerTask   = 20
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type TagService struct {
+	Repo repository.TagRepository
+}
+
+func NewTagService(repo repository.TagRepository) *TagService {
+	return &TagService{Repo: repo}
+}
+
+// TagUpdate lists the tag fields changed by an update; nil fields keep
+// their value.
+type TagUpdate struct {
+	Name  *string
+	Color *string
+}
+
+func (s *TagService) CreateTag(ctx context.Context, tag *models.Tag) error {
+	verr := &ValidationError{}
+	tag.Name = validateTagName(verr, "name", tag.Name)
+	if tag.Color == "" {
+		tag.Color = DefaultTagColor
+	}
+	tag.Color = validateTagColor(verr, tag.Color)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	err := s.Repo.Create(ctx, tag)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return fmt.Errorf("tag %q already exists: %w", tag.Name, ErrConflict)
+	}
+	return err
+}
+
+func (s *TagService) GetTagsByUser(ctx context.Context, userID int) ([]*models.Tag, error) {
+	tags, err := s.Repo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		tags = []*models.Tag{}
+	}
+	return tags, nil
+}
+
+// UpdateTag renames or recolors a tag. Renaming it to the name of another
+// tag is a conflict; MergeTags combines two tags instead.
+func (s *TagService) UpdateTag(ctx context.Context, tagID int, userID int, update TagUpdate) (*models.Tag, error) {
+	tag, err := s.Repo.GetByID(ctx, tagID, userID)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+
+	verr := &ValidationError{}
+	if update.Name != nil {
+		tag.Name = validateTagName(verr, "name", *update.Name)
+	}
+	if update.Color != nil {
+		tag.Color = validateTagColor(verr, *update.Color)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.Repo.Update(ctx, tag)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, fmt.Errorf("tag %q already exists, merge the tags instead: %w", tag.Name, ErrConflict)
+	}
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+	return tag, nil
+}
+
+func (s *TagService) DeleteTag(ctx context.Context, tagID int, userID int) error {
+	return mapRepoError(s.Repo.Delete(ctx, tagID, userID))
+}
+
+// MergeTags moves every task tagged with the source tag to the target tag,
+// deletes the source tag and returns the target.
+func (s *TagService) MergeTags(ctx context.Context, sourceID int, targetID int, userID int) (*models.Tag, error) {
+	if sourceID == targetID {
+		return nil, NewValidationError("into", "cannot merge a tag into itself")
+	}
+	target, err := s.Repo.GetByID(ctx, targetID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, NewValidationError("into", "tag does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.Merge(ctx, sourceID, targetID, userID); err != nil {
+		return nil, mapRepoError(err)
+	}
+	return target, nil
+}
+
+// validateTagName returns the name without surrounding space.
+func validateTagName(verr *ValidationError, field, name string) string {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		verr.Add(field, "tag name is required")
+	case utf8.RuneCountInString(name) > maxTagNameLength:
+		verr.Add(field, fmt.Sprintf("tag name must be at most %d characters", maxTagNameLength))
+	}
+	return name
+}
+
+// validateTagColor returns the color in lower case.
+func validateTagColor(verr *ValidationError, color string) string {
+	if !tagColorPattern.MatchString(color) {
+		verr.Add("color", "color must be a hex color such as #1e88e5")
+	}
+	return strings.ToLower(color)
+}
+
+// normalizeTagNames validates the tag names given for a task and drops
+// duplicates, which are names that only differ in case.
+func normalizeTagNames(verr *ValidationError, names []string) []string {
+	normalized := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = validateTagName(verr, "tags", name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		normalized = append(normalized, name)
+	}
+	if len(normalized) > maxTagsPerTask {
+		verr.Add("tags", fmt.Sprintf("a task can have at most %d tags", maxTagsPerTask))
+	}
+	return normalized
+}
@@ -2,84 +2,427 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
 )
 
 type TaskService struct {
-	DB *sql.DB
+	Repo       repository.TaskRepository
+	Categories repository.CategoryRepository
+	Tags       repository.TagRepository
 }
 
-func NewTaskService(db *sql.DB) *TaskService {
-	return &TaskService{DB: db}
+func NewTaskService(repo repository.TaskRepository, categories repository.CategoryRepository, tags repository.TagRepository) *TaskService {
+	return &TaskService{Repo: repo, Categories: categories, Tags: tags}
 }
 
+// CreateTask stores the task with the tags named in task.Tags. Tags the user
+// does not have yet are created.
 func (s *TaskService) CreateTask(ctx context.Context, task *models.Task) error {
-	query := `INSERT INTO tasks (user_id, title, description, category_id, completed, due_date)
-				VALUES ($1, $2, $3, $4, $5, $6)
-				RETURNING id, created_at`
-	err := s.DB.QueryRowContext(ctx, query, task.UserID, task.Title, task.Description, task.CategoryID, task.Completed, task.DueDate).Scan(&task.ID, &task.CreatedAt)
-	return err
+	if err := s.validate(ctx, task); err != nil {
+		return err
+	}
+	tags, err := s.resolveTags(ctx, task.UserID, task.Tags)
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.Create(ctx, task, tags); err != nil {
+		return err
+	}
+	return s.settleCompletion(ctx, task)
 }
 
-func (s *TaskService) GetTasksByUser(ctx context.Context, userID int, categoryID *int) ([]*models.Task, error) {
-	query := `SELECT id, user_id, title, description, category_id, completed, created_at, due_date
-        FROM tasks WHERE user_id = $1`
-	args := []any{userID}
+type TaskPage struct {
+	Tasks      []*models.Task
+	NextCursor string
+	HasMore    bool
+}
 
-	if categoryID != nil {
-		query += " AND category_id = $2"
-		args = append(args, *categoryID)
+func (s *TaskService) GetTasksByUser(ctx context.Context, filter repository.TaskFilter) (*TaskPage, error) {
+	if len(filter.Tags) > 0 {
+		tags, err := s.Tags.GetByNames(ctx, filter.UserID, filter.Tags)
+		if err != nil {
+			return nil, err
+		}
+		// A tag the user does not have matches no task.
+		if len(tags) == 0 || (filter.AllTags && len(tags) < countDistinctFold(filter.Tags)) {
+			return &TaskPage{}, nil
+		}
+		filter.TagIDs = nil
+		for _, t := range tags {
+			filter.TagIDs = append(filter.TagIDs, t.ID)
+		}
+	}
+
+	limit := filter.Limit
+	// Fetch one extra row to find out whether another page exists.
+	filter.Limit = limit + 1
+	tasks, err := s.Repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	query += " ORDER BY created_at DESC"
+	page := &TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		page.HasMore = true
+		last := page.Tasks[limit-1]
+		page.NextCursor = repository.NewTaskCursor(last, filter.Sort, filter.Descending).Encode()
+	}
+	return page, nil
+}
 
-	rows, err := s.DB.QueryContext(ctx, query, args...)
+// TaskMatrix sorts open tasks into the quadrants of an Eisenhower matrix,
+// as placed by repository.QuadrantOf relative to UrgentBefore.
+type TaskMatrix struct {
+	UrgentBefore time.Time
+	// Do holds the important, urgent tasks.
+	Do repository.TaskQuadrant
+	// Schedule holds the important tasks that are not urgent.
+	Schedule repository.TaskQuadrant
+	// Delegate holds the urgent tasks that are not important.
+	Delegate repository.TaskQuadrant
+	// Eliminate holds the tasks that are neither.
+	Eliminate repository.TaskQuadrant
+}
+
+// GetTaskMatrix buckets the open tasks of the user, subtasks included, and
+// keeps the first limit tasks of each quadrant. Each quadrant lists the
+// tasks due soonest first, then by priority.
+func (s *TaskService) GetTaskMatrix(ctx context.Context, userID int, urgentBefore time.Time, limit int) (*TaskMatrix, error) {
+	quadrants, err := s.Repo.Matrix(ctx, userID, urgentBefore, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	for i := range quadrants {
+		if quadrants[i].Tasks == nil {
+			quadrants[i].Tasks = []*models.Task{}
+		}
+	}
+	return &TaskMatrix{
+		UrgentBefore: urgentBefore,
+		Do:           quadrants[repository.QuadrantDo],
+		Schedule:     quadrants[repository.QuadrantSchedule],
+		Delegate:     quadrants[repository.QuadrantDelegate],
+		Eliminate:    quadrants[repository.QuadrantEliminate],
+	}, nil
+}
 
-	var tasks []*models.Task
-	for rows.Next() {
-		var t models.Task
-		err := rows.Scan(&t.ID, &t.UserID, &t.Title, &t.Description, &t.CategoryID, &t.Completed, &t.CreatedAt, &t.DueDate)
-		if err != nil {
-			return nil, err
+// GetTasksByCategory lists the tasks of one category, failing with
+// ErrNotFound when the category does not belong to the user.
+func (s *TaskService) GetTasksByCategory(ctx context.Context, categoryID int, filter repository.TaskFilter) (*TaskPage, error) {
+	if _, err := s.Categories.GetByID(ctx, categoryID, filter.UserID); err != nil {
+		return nil, mapRepoError(err)
+	}
+	filter.CategoryID = &categoryID
+	return s.GetTasksByUser(ctx, filter)
+}
+
+// IncludeTags fills in the tag names of each task.
+func (s *TaskService) IncludeTags(ctx context.Context, userID int, tasks ...*models.Task) error {
+	ids := make([]int, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	tags, err := s.Tags.TaskTags(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		t.Tags = tags[t.ID]
+	}
+	return nil
+}
+
+// IncludeProgress fills in the progress of each task that has subtasks.
+func (s *TaskService) IncludeProgress(ctx context.Context, userID int, tasks ...*models.Task) error {
+	ids := make([]int, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID
+	}
+	progress, err := s.Repo.Progress(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		t.Progress = progress[t.ID]
+	}
+	return nil
+}
+
+// GetSubtasks returns the task with its subtasks nested below it, each
+// with the progress of the subtasks under it.
+func (s *TaskService) GetSubtasks(ctx context.Context, taskID int, userID int) (*models.TaskNode, error) {
+	tasks, err := s.Repo.Subtree(ctx, taskID, userID)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+
+	if err := s.IncludeTags(ctx, userID, tasks...); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]*models.TaskNode, len(tasks))
+	for _, t := range tasks {
+		nodes[t.ID] = &models.TaskNode{Task: t, Subtasks: []*models.TaskNode{}}
+	}
+	for _, t := range tasks[1:] {
+		parent := nodes[*t.ParentID]
+		parent.Subtasks = append(parent.Subtasks, nodes[t.ID])
+	}
+
+	// Subtree lists shallower tasks first, so walking it backwards sees
+	// every subtask before its parent.
+	type count struct{ subtasks, completed int }
+	counts := make(map[int]count, len(tasks))
+	for i := len(tasks) - 1; i >= 0; i-- {
+		node := nodes[tasks[i].ID]
+		var c count
+		for _, child := range node.Subtasks {
+			cc := counts[child.ID]
+			c.subtasks += 1 + cc.subtasks
+			c.completed += cc.completed
+			if child.Completed {
+				c.completed++
+			}
+		}
+		counts[node.ID] = c
+		if c.subtasks > 0 {
+			node.Progress = models.NewTaskProgress(c.subtasks, c.completed)
 		}
-		tasks = append(tasks, &t)
 	}
-	return tasks, nil
+	return nodes[taskID], nil
 }
 
-func (s *TaskService) UpdateTask(ctx context.Context, task *models.Task) error {
-	query := `UPDATE tasks SET title = $1, description = $2, category_id = $3,completed = $4, due_date = $5 WHERE id = $6 AND user_id = $7`
-	_, err := s.DB.ExecContext(ctx, query, task.Title, task.Description, task.CategoryID, task.Completed, task.DueDate, task.ID, task.UserID)
-	return err
+// IncludeCategories embeds the category of each task that has one, loading
+// all categories of the user in a single query.
+func (s *TaskService) IncludeCategories(ctx context.Context, userID int, tasks ...*models.Task) error {
+	categories, err := s.Categories.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]*models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	for _, t := range tasks {
+		if t.CategoryID != nil {
+			t.Category = byID[*t.CategoryID]
+		}
+	}
+	return nil
 }
 
-func (s *TaskService) DeleteTask(ctx context.Context, taskID int, userID int) error {
-	query := `DELETE FROM tasks WHERE id = $1 AND user_id = $2`
-	_, err := s.DB.ExecContext(ctx, query, taskID, userID)
-	return err
+// UpdateTask replaces the task. When ifVersion is set the update only applies
+// if the stored task still has that version. The tags are only replaced when
+// task.Tags is not nil.
+func (s *TaskService) UpdateTask(ctx context.Context, task *models.Task, ifVersion *int) error {
+	if err := s.validate(ctx, task); err != nil {
+		return err
+	}
+	var tags []*models.Tag
+	if task.Tags != nil {
+		var err error
+		if tags, err = s.resolveTags(ctx, task.UserID, task.Tags); err != nil {
+			return err
+		}
+	}
+	if err := s.Repo.Update(ctx, task, tags, ifVersion); err != nil {
+		return mapRepoError(err)
+	}
+	return s.settleCompletion(ctx, task)
 }
 
-func (s *TaskService) MarkTaskCompletion(ctx context.Context, taskID int, userID int, completed bool) error {
-	query := `UPDATE tasks SET completed = $1 WHERE id = $2 AND user_id = $3`
-	_, err := s.DB.ExecContext(ctx, query, completed, taskID, userID)
-	return err
+// DeleteTask deletes the task together with all its subtasks.
+func (s *TaskService) DeleteTask(ctx context.Context, taskID int, userID int, ifVersion *int) error {
+	return mapRepoError(s.Repo.Delete(ctx, taskID, userID, ifVersion))
+}
+
+func (s *TaskService) PatchTask(ctx context.Context, taskID int, userID int, patch models.TaskPatch, ifVersion *int) (*models.Task, error) {
+	verr := &ValidationError{}
+	if patch.Title.Set && (patch.Title.Value == nil || strings.TrimSpace(*patch.Title.Value) == "") {
+		verr.Add("title", "title is required")
+	}
+	if patch.Completed.Set && patch.Completed.Value == nil {
+		verr.Add("completed", "completed cannot be null")
+	}
+	if patch.Priority.Set && (patch.Priority.Value == nil || !patch.Priority.Value.Valid()) {
+		verr.Add("priority", priorityMessage)
+	}
+	if patch.DueDate.Set && patch.DueDate.Value != nil && patch.DueDate.Value.Before(time.Now()) {
+		verr.Add("due_date", "due date cannot be in the past")
+	}
+	if patch.CategoryID.Set && patch.CategoryID.Value != nil {
+		if err := s.checkCategory(ctx, *patch.CategoryID.Value, userID, verr); err != nil {
+			return nil, err
+		}
+	}
+	if patch.ParentID.Set && patch.ParentID.Value != nil {
+		if err := s.checkParent(ctx, *patch.ParentID.Value, taskID, userID, verr); err != nil {
+			return nil, err
+		}
+	}
+	var tagNames []string
+	if patch.Tags.Set && patch.Tags.Value != nil {
+		tagNames = normalizeTagNames(verr, *patch.Tags.Value)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	tags, err := s.resolveTags(ctx, userID, tagNames)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := s.Repo.Patch(ctx, taskID, userID, patch, tags, ifVersion)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+	if !patch.Tags.Set {
+		if err := s.IncludeTags(ctx, userID, task); err != nil {
+			return nil, err
+		}
+	}
+	if patch.Completed.Set || patch.ParentID.Set {
+		if err := s.settleCompletion(ctx, task); err != nil {
+			return nil, err
+		}
+	}
+	return task, nil
 }
 
 func (s *TaskService) GetTaskByID(ctx context.Context, taskID int, userID int) (*models.Task, error) {
-	query := `SELECT id, user_id, title, description, category_id, completed, created_at, due_date FROM tasks WHERE id = $1 AND user_id = $2`
-	row := s.DB.QueryRowContext(ctx, query, taskID, userID)
+	task, err := s.Repo.GetByID(ctx, taskID, userID)
+	if err != nil {
+		return nil, mapRepoError(err)
+	}
+	if err := s.IncludeTags(ctx, userID, task); err != nil {
+		return nil, err
+	}
+	if err := s.IncludeProgress(ctx, userID, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *TaskService) validate(ctx context.Context, task *models.Task) error {
+	verr := &ValidationError{}
+	if strings.TrimSpace(task.Title) == "" {
+		verr.Add("title", "title is required")
+	}
+	if !task.Priority.Valid() {
+		verr.Add("priority", priorityMessage)
+	}
+	if task.DueDate != nil && task.DueDate.Before(time.Now()) {
+		verr.Add("due_date", "due date cannot be in the past")
+	}
+	if task.CategoryID != nil {
+		if err := s.checkCategory(ctx, *task.CategoryID, task.UserID, verr); err != nil {
+			return err
+		}
+	}
+	if task.ParentID != nil {
+		if err := s.checkParent(ctx, *task.ParentID, task.ID, task.UserID, verr); err != nil {
+			return err
+		}
+	}
+	if task.Tags != nil {
+		task.Tags = normalizeTagNames(verr, task.Tags)
+	}
+	return verr.Err()
+}
 
-	var task models.Task
-	err := row.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.CategoryID, &task.Completed, &task.CreatedAt, &task.DueDate)
+var priorityMessage = "priority must be one of " + strings.Join(models.PriorityNames(), ", ")
+
+// countDistinctFold counts the names that differ other than in case.
+func countDistinctFold(names []string) int {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[strings.ToLower(name)] = true
+	}
+	return len(seen)
+}
+
+// resolveTags returns the user's tags with the given names. Names the user
+// has no tag for yet get a new tag without an ID, which the task repository
+// creates in the same transaction as the task.
+func (s *TaskService) resolveTags(ctx context.Context, userID int, names []string) ([]*models.Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	tags, err := s.Tags.GetByNames(ctx, userID, names)
 	if err != nil {
 		return nil, err
 	}
+	for _, name := range names {
+		exists := slices.ContainsFunc(tags, func(t *models.Tag) bool {
+			return strings.EqualFold(t.Name, name)
+		})
+		if exists {
+			continue
+		}
+		tags = append(tags, &models.Tag{UserID: userID, Name: name, Color: DefaultTagColor})
+	}
+	return tags, nil
+}
+
+// checkParent reports a validation problem when the parent does not belong
+// to the user or would make the task its own ancestor. taskID is zero for
+// tasks that do not exist yet. The repository checks for cycles again when
+// it saves the parent, in case another move got in between.
+func (s *TaskService) checkParent(ctx context.Context, parentID int, taskID int, userID int, verr *ValidationError) error {
+	if parentID == taskID {
+		verr.Add("parent_id", "a task cannot be its own parent")
+		return nil
+	}
+	_, err := s.Repo.GetByID(ctx, parentID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		verr.Add("parent_id", "parent task does not exist")
+		return nil
+	}
+	if err != nil || taskID == 0 {
+		return err
+	}
+
+	subtree, err := s.Repo.Subtree(ctx, taskID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// The update itself reports the missing task.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, t := range subtree {
+		if t.ID == parentID {
+			verr.Add("parent_id", "parent task cannot be a subtask of this task")
+			break
+		}
+	}
+	return nil
+}
+
+// settleCompletion keeps a completed task from having open subtasks:
+// completing a task completes everything below it, and an open task reopens
+// the completed tasks above it.
+func (s *TaskService) settleCompletion(ctx context.Context, task *models.Task) error {
+	if task.Completed {
+		return s.Repo.CompleteSubtasks(ctx, task.ID, task.UserID)
+	}
+	return s.Repo.ReopenAncestors(ctx, task.ID, task.UserID)
+}
 
-	return &task, nil
+// checkCategory reports a validation problem when the category does not
+// belong to the user, so tasks cannot point at someone else's category.
+func (s *TaskService) checkCategory(ctx context.Context, categoryID int, userID int, verr *ValidationError) error {
+	_, err := s.Categories.GetByID(ctx, categoryID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		verr.Add("category_id", "category does not exist")
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+func newTestTaskService() *TaskService {
+	tasks := repository.NewMemoryTaskRepository()
+	return NewTaskService(tasks, repository.NewMemoryCategoryRepository(), repository.NewMemoryTagRepository(tasks))
+}
+
+func createTestTask(t *testing.T, s *TaskService, task *models.Task) *models.Task {
+	t.Helper()
+	if err := s.CreateTask(context.Background(), task); err != nil {
+		t.Fatalf("create %q: %v", task.Title, err)
+	}
+	return task
+}
+
+func validationFields(err error) []string {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	var fields []string
+	for f := range verr.Fields {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+func TestCreateTaskValidates(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	other := &models.Category{UserID: 2, Name: "Someone else's"}
+	if err := s.Categories.Create(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		task  models.Task
+		field string
+	}{
+		{"blank title", models.Task{UserID: 1, Title: "  "}, "title"},
+		{"invalid priority", models.Task{UserID: 1, Title: "t", Priority: 9}, "priority"},
+		{"due in the past", models.Task{UserID: 1, Title: "t", DueDate: &past}, "due_date"},
+		{"foreign category", models.Task{UserID: 1, Title: "t", CategoryID: &other.ID}, "category_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CreateTask(ctx, &tt.task)
+			if !errors.Is(err, ErrValidation) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+			if got := validationFields(err); !slices.Equal(got, []string{tt.field}) {
+				t.Errorf("fields = %v, want [%s]", got, tt.field)
+			}
+		})
+	}
+}
+
+func TestCreateTaskCreatesTags(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	existing := &models.Tag{UserID: 1, Name: "Work", Color: DefaultTagColor}
+	if err := s.Tags.Create(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	task := createTestTask(t, s, &models.Task{UserID: 1, Title: "Report", Tags: []string{"work", "urgent"}})
+
+	got, err := s.GetTaskByID(ctx, task.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"urgent", "Work"}; !slices.Equal(got.Tags, want) {
+		t.Errorf("tags = %v, want %v", got.Tags, want)
+	}
+	tags, err := s.Tags.ListByUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 {
+		t.Errorf("user has %d tags, want the existing one and one new", len(tags))
+	}
+}
+
+func TestFailedTaskWriteCreatesNoTags(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	task := createTestTask(t, s, &models.Task{UserID: 1, Title: "Draft"})
+	stale := task.Version - 1
+
+	task.Tags = []string{"orphan"}
+	if err := s.UpdateTask(ctx, task, &stale); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("err = %v, want ErrPreconditionFailed", err)
+	}
+	tags, err := s.Tags.ListByUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("the failed update left tags %v behind", tags)
+	}
+}
+
+func TestGetTaskByIDIsPerUser(t *testing.T) {
+	s := newTestTaskService()
+	task := createTestTask(t, s, &models.Task{UserID: 1, Title: "Mine"})
+
+	if _, err := s.GetTaskByID(context.Background(), task.ID, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteTask(context.Background(), task.ID, 2, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateTaskChecksVersion(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	task := createTestTask(t, s, &models.Task{UserID: 1, Title: "Draft"})
+	stale := task.Version
+
+	task.Title = "Final"
+	if err := s.UpdateTask(ctx, task, &stale); err != nil {
+		t.Fatal(err)
+	}
+	if task.Version == stale {
+		t.Error("update did not bump the version")
+	}
+
+	task.Title = "Lost update"
+	if err := s.UpdateTask(ctx, task, &stale); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("err = %v, want ErrPreconditionFailed", err)
+	}
+	got, err := s.GetTaskByID(ctx, task.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Final" {
+		t.Errorf("title = %q, want Final", got.Title)
+	}
+}
+
+func TestGetTasksByUserPages(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		createTestTask(t, s, &models.Task{UserID: 1, Title: title})
+	}
+	createTestTask(t, s, &models.Task{UserID: 2, Title: "not mine"})
+
+	filter := repository.TaskFilter{UserID: 1, Sort: repository.SortTitle, Limit: 2}
+	var titles []string
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("paging does not end")
+		}
+		page, err := s.GetTasksByUser(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, task := range page.Tasks {
+			titles = append(titles, task.Title)
+		}
+		if !page.HasMore {
+			break
+		}
+		if filter.Cursor, err = repository.DecodeTaskCursor(page.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(titles, want) {
+		t.Errorf("titles = %v, want %v", titles, want)
+	}
+}
+
+func TestGetTasksByUserUnknownTag(t *testing.T) {
+	s := newTestTaskService()
+	createTestTask(t, s, &models.Task{UserID: 1, Title: "Tagged", Tags: []string{"home"}})
+
+	page, err := s.GetTasksByUser(context.Background(), repository.TaskFilter{UserID: 1, Tags: []string{"home", "nope"}, AllTags: true, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tasks) != 0 {
+		t.Errorf("got %d tasks, want none", len(page.Tasks))
+	}
+}
+
+func TestGetTasksByCategory(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	category := &models.Category{UserID: 1, Name: "Home"}
+	if err := s.Categories.Create(ctx, category); err != nil {
+		t.Fatal(err)
+	}
+	in := createTestTask(t, s, &models.Task{UserID: 1, Title: "Dishes", CategoryID: &category.ID})
+	createTestTask(t, s, &models.Task{UserID: 1, Title: "Email"})
+
+	page, err := s.GetTasksByCategory(ctx, category.ID, repository.TaskFilter{UserID: 1, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].ID != in.ID {
+		t.Errorf("got %v, want only task %d", page.Tasks, in.ID)
+	}
+	if _, err := s.GetTasksByCategory(ctx, category.ID, repository.TaskFilter{UserID: 2, Limit: 10}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other user's err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSubtaskCompletion(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	parent := createTestTask(t, s, &models.Task{UserID: 1, Title: "Move"})
+	child := createTestTask(t, s, &models.Task{UserID: 1, Title: "Pack", ParentID: &parent.ID})
+	grandchild := createTestTask(t, s, &models.Task{UserID: 1, Title: "Buy boxes", ParentID: &child.ID})
+
+	done := true
+	if _, err := s.PatchTask(ctx, parent.ID, 1, models.TaskPatch{Completed: models.Optional[bool]{Set: true, Value: &done}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := s.GetSubtasks(ctx, parent.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Subtasks[0].Completed || !tree.Subtasks[0].Subtasks[0].Completed {
+		t.Error("completing the parent left subtasks open")
+	}
+	if tree.Progress == nil || tree.Progress.Percent != 100 {
+		t.Errorf("progress = %+v, want 100%%", tree.Progress)
+	}
+
+	open := false
+	if _, err := s.PatchTask(ctx, grandchild.ID, 1, models.TaskPatch{Completed: models.Optional[bool]{Set: true, Value: &open}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTaskByID(ctx, parent.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Completed {
+		t.Error("reopening a subtask left its ancestor completed")
+	}
+	if want := models.NewTaskProgress(2, 0); got.Progress == nil || *got.Progress != *want {
+		t.Errorf("progress = %+v, want %+v", got.Progress, want)
+	}
+}
+
+func TestSubtaskCannotBecomeItsOwnAncestor(t *testing.T) {
+	s := newTestTaskService()
+	parent := createTestTask(t, s, &models.Task{UserID: 1, Title: "Parent"})
+	child := createTestTask(t, s, &models.Task{UserID: 1, Title: "Child", ParentID: &parent.ID})
+
+	_, err := s.PatchTask(context.Background(), parent.ID, 1, models.TaskPatch{ParentID: models.Optional[int]{Set: true, Value: &child.ID}}, nil)
+	if got := validationFields(err); !slices.Equal(got, []string{"parent_id"}) {
+		t.Errorf("err = %v, want a parent_id validation error", err)
+	}
+}
+
+func TestConcurrentMovesCannotCloseACycle(t *testing.T) {
+	s := newTestTaskService()
+	a := createTestTask(t, s, &models.Task{UserID: 1, Title: "A"})
+	b := createTestTask(t, s, &models.Task{UserID: 1, Title: "B"})
+
+	// Both moves pass the service's own check before either is saved, so
+	// only the repository can refuse the second.
+	move := func(taskID, parentID int) error {
+		_, err := s.Repo.Patch(context.Background(), taskID, 1, models.TaskPatch{ParentID: models.Optional[int]{Set: true, Value: &parentID}}, nil, nil)
+		return err
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- move(a.ID, b.ID) }()
+	go func() { errs <- move(b.ID, a.ID) }()
+
+	var cycles int
+	for range 2 {
+		err := <-errs
+		if errors.Is(err, repository.ErrParentCycle) {
+			cycles++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cycles != 1 {
+		t.Errorf("%d moves refused, want 1", cycles)
+	}
+}
+
+func TestConcurrentTagPatchesCheckVersion(t *testing.T) {
+	s := newTestTaskService()
+	task := createTestTask(t, s, &models.Task{UserID: 1, Title: "Report"})
+
+	// Both writers read the same version; only one may apply its tags.
+	patch := func(tag string) error {
+		names := []string{tag}
+		_, err := s.PatchTask(context.Background(), task.ID, 1, models.TaskPatch{Tags: models.Optional[[]string]{Set: true, Value: &names}}, &task.Version)
+		return err
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- patch("home") }()
+	go func() { errs <- patch("work") }()
+
+	var conflicts int
+	for range 2 {
+		err := <-errs
+		if errors.Is(err, ErrPreconditionFailed) {
+			conflicts++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("%d patches refused, want 1", conflicts)
+	}
+	got, err := s.GetTaskByID(context.Background(), task.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != task.Version+1 || len(got.Tags) != 1 {
+		t.Errorf("task has version %d and tags %v, want version %d and one tag", got.Version, got.Tags, task.Version+1)
+	}
+	tags, err := s.Tags.ListByUser(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 {
+		t.Errorf("user has %d tags, want only the applied one", len(tags))
+	}
+}
+
+func TestGetTaskMatrix(t *testing.T) {
+	s := newTestTaskService()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	soon := now.Add(time.Hour)
+	urgentBefore := now.Add(48 * time.Hour)
+
+	task := func(title string, priority models.Priority, due *time.Time) *models.Task {
+		return createTestTask(t, s, &models.Task{UserID: 1, Title: title, Priority: priority, DueDate: due})
+	}
+	urgent := task("urgent", models.PriorityUrgent, nil)
+	highSoon := task("high soon", models.PriorityHigh, &soon)
+	high := task("high", models.PriorityHigh, nil)
+	lowSoon := task("low soon", models.PriorityLow, &soon)
+	medium := task("medium", models.PriorityMedium, nil)
+	low := task("low", models.PriorityLow, nil)
+	task("none", models.PriorityNone, nil)
+	done := task("done", models.PriorityUrgent, nil)
+	completed := true
+	if _, err := s.PatchTask(ctx, done.ID, 1, models.TaskPatch{Completed: models.Optional[bool]{Set: true, Value: &completed}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	matrix, err := s.GetTaskMatrix(ctx, 1, urgentBefore, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(q repository.TaskQuadrant) []int {
+		var ids []int
+		for _, task := range q.Tasks {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		name  string
+		got   repository.TaskQuadrant
+		want  []int
+		total int
+	}{
+		{"do", matrix.Do, []int{highSoon.ID, urgent.ID}, 2},
+		{"schedule", matrix.Schedule, []int{high.ID}, 1},
+		{"delegate", matrix.Delegate, []int{lowSoon.ID}, 1},
+		{"eliminate", matrix.Eliminate, []int{medium.ID, low.ID}, 3},
+	} {
+		if got := ids(tc.got); !slices.Equal(got, tc.want) || tc.got.Total != tc.total {
+			t.Errorf("%s: got %v of %d, want %v of %d", tc.name, got, tc.got.Total, tc.want, tc.total)
+		}
+	}
+}
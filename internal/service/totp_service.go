@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/repository"
+)
+
+const (
+	totpPeriod        = 30
+	totpQRSize        = 256
+	recoveryCodeCount = 10
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+var (
+	ErrInvalidMFACode = fmt.Errorf("invalid authentication code: %w", ErrUnauthorized)
+	errInvalidCode    = NewValidationError("code", "invalid authentication code")
+)
+
+type TOTPService struct {
+	Users  *repository.UserRepository
+	Repo   *repository.TOTPRepository
+	Issuer string
+	// Limits are the login limits. Wrong codes given to confirm a change
+	// count against them like wrong codes at login, so the second factor
+	// cannot be guessed through a stolen access token instead.
+	Limits LoginLimits
+}
+
+func NewTOTPService(users *repository.UserRepository, repo *repository.TOTPRepository, issuer string, limits LoginLimits) *TOTPService {
+	return &TOTPService{Users: users, Repo: repo, Issuer: issuer, Limits: limits}
+}
+
+// TOTPEnrollment is what an authenticator app needs to add the account.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	// QRCode is a PNG image of URI.
+	QRCode []byte
+}
+
+// Enroll creates a new secret for the user. It only takes effect after
+// Confirm proves the authenticator app was set up correctly.
+func (s *TOTPService) Enroll(ctx context.Context, userID int) (*TOTPEnrollment, error) {
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	account := user.Username
+	if user.Email != "" {
+		account = user.Email
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.Issuer,
+		AccountName: account,
+		Period:      totpOpts.Period,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SavePending(ctx, userID, key.Secret()); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, fmt.Errorf("two-factor authentication is already enabled: %w", ErrConflict)
+		}
+		return nil, err
+	}
+
+	img, err := key.Image(totpQRSize, totpQRSize)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: key.Secret(), URI: key.URL(), QRCode: buf.Bytes()}, nil
+}
+
+// Confirm enables TOTP once the user enters a valid code and returns a
+// fresh set of recovery codes. They are only ever shown here.
+func (s *TOTPService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	t, err := s.Repo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("start the enrollment first: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.EnabledAt != nil {
+		return nil, fmt.Errorf("two-factor authentication is already enabled: %w", ErrConflict)
+	}
+
+	step, ok := matchTOTP(t.Secret, code, time.Now())
+	if !ok {
+		return nil, errInvalidCode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, mapRepoError(err)
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a code.
+func (s *TOTPService) Disable(ctx context.Context, actor Actor, code string) error {
+	if err := s.verifyEnabled(ctx, actor, code); err != nil {
+		return err
+	}
+	return s.Repo.Delete(ctx, actor.UserID)
+}
+
+// RegenerateRecoveryCodes invalidates the old recovery codes and returns
+// new ones after checking a code.
+func (s *TOTPService) RegenerateRecoveryCodes(ctx context.Context, actor Actor, code string) ([]string, error) {
+	if err := s.verifyEnabled(ctx, actor, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.ReplaceRecoveryCodes(ctx, actor.UserID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Enabled reports whether logging in needs a second factor.
+func (s *TOTPService) Enabled(ctx context.Context, userID int) (bool, error) {
+	t, err := s.Repo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.EnabledAt != nil, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code. A
+// TOTP code works only once and recovery codes are used up.
+func (s *TOTPService) Verify(ctx context.Context, userID int, code string) error {
+	t, err := s.Repo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	if t.EnabledAt == nil {
+		return ErrInvalidMFACode
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpOpts.Digits.Length() {
+		step, ok := matchTOTP(t.Secret, code, time.Now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		err = s.Repo.UseStep(ctx, userID, step)
+	} else {
+		err = s.Repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	}
+	if errors.Is(err, repository.ErrTokenAlreadyUsed) || errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+// verifyEnabled checks the code of a signed in user under the same limits
+// as CompleteMFA.
+func (s *TOTPService) verifyEnabled(ctx context.Context, actor Actor, code string) error {
+	user, err := s.Users.GetByID(actor.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+	if err := s.Limits.check(user.Username, actor.IP); err != nil {
+		return err
+	}
+	err = s.Verify(ctx, user.ID, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		enabled, enabledErr := s.Enabled(ctx, user.ID)
+		if enabledErr != nil {
+			return enabledErr
+		}
+		if !enabled {
+			return fmt.Errorf("two-factor authentication is not enabled: %w", ErrNotFound)
+		}
+		s.Limits.fail(user.Username, actor.IP)
+		return errInvalidCode
+	}
+	return err
+}
+
+// matchTOTP checks code against the current time step and one step either
+// side to allow for clock drift, and returns the step that matched.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	for _, skew := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		want, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return t.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns codes formatted like "abcd-efgh" and the
+// hashes they are stored under.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))
+		codes[i] = raw[:4] + "-" + raw[4:]
+		hashes[i] = hashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
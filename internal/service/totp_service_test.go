@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/MuhammadrasulGasanov/go-tasks/internal/models"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(secret, at, totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// wrongCode returns a code that differs from code in its last digit.
+func wrongCode(code string) string {
+	last := (code[len(code)-1]-'0'+1)%10 + '0'
+	return code[:len(code)-1] + string(rune(last))
+}
+
+func TestMatchTOTPAllowsOneStepOfSkew(t *testing.T) {
+	now := time.Date(2026, 3, 4, 5, 6, 15, 0, time.UTC)
+	step := now.Unix() / totpPeriod
+
+	for _, tc := range []struct {
+		name   string
+		offset time.Duration
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"previous step", -totpPeriod * time.Second, true},
+		{"next step", totpPeriod * time.Second, true},
+		{"two steps behind", -2 * totpPeriod * time.Second, false},
+		{"two steps ahead", 2 * totpPeriod * time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			at := now.Add(tc.offset)
+			got, ok := matchTOTP(testTOTPSecret, totpCode(t, testTOTPSecret, at), now)
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			if want := at.Unix() / totpPeriod; ok && got != want {
+				t.Errorf("step = %d, want %d (current %d)", got, want, step)
+			}
+		})
+	}
+
+	if _, ok := matchTOTP(testTOTPSecret, wrongCode(totpCode(t, testTOTPSecret, now)), now); ok {
+		t.Error("a wrong code matched")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	for _, code := range []string{"abcd-efgh", "ABCD-EFGH", "abcdefgh", "abcd efgh", " AbCd-EfGh"} {
+		if got := normalizeRecoveryCode(code); got != "abcdefgh" {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", code, got, "abcdefgh")
+		}
+	}
+}
+
+// enableTestTOTP enrolls the user and confirms the enrollment with the
+// code of the current step. It returns the secret, the recovery codes and
+// the time the confirming code was made for.
+func enableTestTOTP(t *testing.T, s *TOTPService, userID int) (string, []string, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := s.Enroll(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	codes, err := s.Confirm(ctx, userID, totpCode(t, enrollment.Secret, at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret, codes, at
+}
+
+func TestTOTPCodesWorkOnce(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	auth := newTestAuthService(db)
+	user := createTestUser(t, auth.Repo, "alice", "alice@example.com", true)
+	secret, _, confirmedAt := enableTestTOTP(t, auth.TOTP, user.ID)
+
+	// Confirm used up its step, so its code is refused while the code of
+	// the next step, still within the allowed skew, works once.
+	if err := auth.TOTP.Verify(ctx, user.ID, totpCode(t, secret, confirmedAt)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed code: err = %v, want ErrInvalidMFACode", err)
+	}
+	next := totpCode(t, secret, confirmedAt.Add(totpPeriod*time.Second))
+	if err := auth.TOTP.Verify(ctx, user.ID, next); err != nil {
+		t.Fatalf("next step: %v", err)
+	}
+	if err := auth.TOTP.Verify(ctx, user.ID, next); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("next step again: err = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	auth := newTestAuthService(db)
+	user := createTestUser(t, auth.Repo, "alice", "alice@example.com", true)
+	_, codes, _ := enableTestTOTP(t, auth.TOTP, user.ID)
+
+	// Codes are accepted however the user types them.
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if err := auth.TOTP.Verify(ctx, user.ID, typed); err != nil {
+		t.Fatalf("recovery code %q: %v", typed, err)
+	}
+	if err := auth.TOTP.Verify(ctx, user.ID, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("used recovery code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if err := auth.TOTP.Verify(ctx, user.ID, codes[1]); err != nil {
+		t.Errorf("another recovery code: %v", err)
+	}
+}
+
+func TestCompleteMFA(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	auth := newTestAuthService(db)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: string(hash)}
+	if err := auth.Repo.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, confirmedAt := enableTestTOTP(t, auth.TOTP, user.ID)
+	client := ClientInfo{IP: "192.0.2.1", UserAgent: "test"}
+
+	result, err := auth.Login(ctx, "alice", "correct horse", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MFAToken == "" || result.Tokens != nil {
+		t.Fatalf("login gave %+v, want only an MFA token", result)
+	}
+
+	code := totpCode(t, secret, confirmedAt.Add(totpPeriod*time.Second))
+	if _, err := auth.CompleteMFA(ctx, result.MFAToken, wrongCode(code), client); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code: err = %v, want ErrInvalidMFACode", err)
+	}
+	if _, err := auth.CompleteMFA(ctx, "not-a-token", code, client); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("bad MFA token: err = %v, want ErrInvalidMFAToken", err)
+	}
+
+	done, err := auth.CompleteMFA(ctx, result.MFAToken, code, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Tokens == nil || done.Tokens.AccessToken == "" || done.Tokens.RefreshToken == "" {
+		t.Errorf("CompleteMFA gave %+v, want tokens", done)
+	}
+}
@@ -1,7 +1,11 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -10,20 +14,44 @@ import (
 )
 
 type UserService struct {
-	Repo *repository.UserRepository
+	Repo   *repository.UserRepository
+	Policy *PasswordPolicy
+	Emails *EmailService
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{Repo: repo}
+func NewUserService(repo *repository.UserRepository, policy *PasswordPolicy, emails *EmailService) *UserService {
+	return &UserService{Repo: repo, Policy: policy, Emails: emails}
 }
 
-func (s *UserService) Register(username, password string) (*models.User, error) {
+// Register creates the account and mails a verification link to its
+// address. Features that need a verified address stay locked until then.
+func (s *UserService) Register(ctx context.Context, username, email, password string) (*models.User, error) {
+	verr := &ValidationError{}
+	if strings.TrimSpace(username) == "" {
+		verr.Add("username", "username is required")
+	}
+	email, ok := normalizeEmail(email)
+	if !ok {
+		verr.Add("email", "must be a valid email address")
+	}
+	s.Policy.Validate(verr, "password", password, username)
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
 	existing, err := s.Repo.GetByUsername(username)
 	if err != nil {
 		return nil, err
 	}
 	if existing != nil {
-		return nil, errors.New("username already exists")
+		return nil, fmt.Errorf("username already exists: %w", ErrConflict)
+	}
+	existing, err = s.Repo.GetByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("email already in use: %w", ErrConflict)
 	}
 
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -33,13 +61,20 @@ func (s *UserService) Register(username, password string) (*models.User, error)
 
 	user := &models.User{
 		Username:     username,
+		Email:        email,
 		PasswordHash: string(hashed),
 	}
 
 	err = s.Repo.Create(user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return nil, fmt.Errorf("username or email already exists: %w", ErrConflict)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.Emails.SendVerification(ctx, user); err != nil {
+		log.Printf("send verification mail to user %d: %v", user.ID, err)
+	}
 	return user, nil
 }
@@ -0,0 +1,134 @@
+// Package throttle slows down repeated failures per key, such as login
+// attempts per username or per client IP. State is kept in memory, so every
+// instance of the server counts on its own.
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// FreeFailures may happen before any delay is imposed.
+	FreeFailures int
+	// BaseDelay doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// After MaxFailures the key is locked for LockoutDuration.
+	MaxFailures     int
+	LockoutDuration time.Duration
+	// Failures are forgotten once a key has been quiet for Window.
+	Window time.Duration
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	blockedTil  time.Time
+}
+
+type Throttle struct {
+	cfg     Config
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func New(cfg Config) *Throttle {
+	return &Throttle{cfg: cfg, entries: map[string]*entry{}, now: time.Now}
+}
+
+// Allow returns zero when the key may try again, or how long it has to wait.
+func (t *Throttle) Allow(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.lookup(key, t.now())
+	if e == nil {
+		return 0
+	}
+	if wait := e.blockedTil.Sub(t.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records a failure and reports whether it locked the key out.
+func (t *Throttle) Fail(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	e := t.lookup(key, now)
+	if e == nil {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+
+	if t.cfg.MaxFailures > 0 && e.failures >= t.cfg.MaxFailures {
+		e.blockedTil = now.Add(t.cfg.LockoutDuration)
+		return true
+	}
+	if extra := e.failures - t.cfg.FreeFailures; extra > 0 {
+		e.blockedTil = now.Add(t.delay(extra))
+	}
+	return false
+}
+
+// Reset forgets the failures of key, e.g. after a successful login.
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// Run drops expired entries every interval until ctx is done.
+func (t *Throttle) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			now := t.now()
+			for key := range t.entries {
+				t.lookup(key, now)
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// lookup returns the entry of key, dropping it first when it has expired.
+// A lockout ends with all failures forgotten.
+func (t *Throttle) lookup(key string, now time.Time) *entry {
+	e, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.Before(e.blockedTil) {
+		return e
+	}
+	locked := t.cfg.MaxFailures > 0 && e.failures >= t.cfg.MaxFailures
+	if locked || now.Sub(e.lastFailure) > t.cfg.Window {
+		delete(t.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (t *Throttle) delay(extra int) time.Duration {
+	d := t.cfg.BaseDelay
+	for i := 1; i < extra && d < t.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > t.cfg.MaxDelay {
+		d = t.cfg.MaxDelay
+	}
+	return d
+}
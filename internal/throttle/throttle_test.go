@@ -0,0 +1,121 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	FreeFailures:    2,
+	BaseDelay:       time.Second,
+	MaxDelay:        4 * time.Second,
+	MaxFailures:     6,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+// newTestThrottle returns a throttle whose clock only moves through the
+// returned function.
+func newTestThrottle(cfg Config) (*Throttle, func(time.Duration)) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := New(cfg)
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestFreeFailures(t *testing.T) {
+	th, _ := newTestThrottle(testConfig)
+	for i := range testConfig.FreeFailures {
+		if th.Fail("alice") {
+			t.Fatalf("failure %d locked the key", i+1)
+		}
+		if wait := th.Allow("alice"); wait != 0 {
+			t.Fatalf("after %d failures wait = %v, want none", i+1, wait)
+		}
+	}
+	th.Fail("alice")
+	if wait := th.Allow("alice"); wait != testConfig.BaseDelay {
+		t.Errorf("after the free failures wait = %v, want %v", wait, testConfig.BaseDelay)
+	}
+	if wait := th.Allow("bob"); wait != 0 {
+		t.Errorf("other key wait = %v, want none", wait)
+	}
+}
+
+func TestDelayDoublesUpToMaxDelay(t *testing.T) {
+	th, advance := newTestThrottle(testConfig)
+	for range testConfig.FreeFailures {
+		th.Fail("alice")
+	}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		th.Fail("alice")
+		if wait := th.Allow("alice"); wait != want {
+			t.Fatalf("wait = %v, want %v", wait, want)
+		}
+		advance(want)
+		if wait := th.Allow("alice"); wait != 0 {
+			t.Fatalf("wait after the delay = %v, want none", wait)
+		}
+	}
+
+	cfg := testConfig
+	cfg.MaxFailures = 0
+	th, _ = newTestThrottle(cfg)
+	for range cfg.FreeFailures + 10 {
+		th.Fail("alice")
+	}
+	if wait := th.Allow("alice"); wait != cfg.MaxDelay {
+		t.Errorf("wait = %v, want it capped at %v", wait, cfg.MaxDelay)
+	}
+}
+
+func TestLockoutForgetsFailuresWhenItEnds(t *testing.T) {
+	th, advance := newTestThrottle(testConfig)
+	for i := range testConfig.MaxFailures {
+		locked := th.Fail("alice")
+		if want := i == testConfig.MaxFailures-1; locked != want {
+			t.Fatalf("failure %d: locked = %v, want %v", i+1, locked, want)
+		}
+	}
+	if wait := th.Allow("alice"); wait != testConfig.LockoutDuration {
+		t.Fatalf("wait = %v, want the lockout of %v", wait, testConfig.LockoutDuration)
+	}
+
+	advance(testConfig.LockoutDuration)
+	if wait := th.Allow("alice"); wait != 0 {
+		t.Fatalf("wait after the lockout = %v, want none", wait)
+	}
+	// The count starts over, so the next failure is a free one again.
+	th.Fail("alice")
+	if wait := th.Allow("alice"); wait != 0 {
+		t.Errorf("wait after one new failure = %v, want none", wait)
+	}
+}
+
+func TestFailuresExpireAfterWindow(t *testing.T) {
+	th, advance := newTestThrottle(testConfig)
+	for range testConfig.FreeFailures {
+		th.Fail("alice")
+	}
+
+	advance(testConfig.Window + time.Second)
+	th.Fail("alice")
+	if wait := th.Allow("alice"); wait != 0 {
+		t.Errorf("wait = %v, want none once the earlier failures expired", wait)
+	}
+}
+
+func TestReset(t *testing.T) {
+	th, _ := newTestThrottle(testConfig)
+	for range testConfig.FreeFailures + 1 {
+		th.Fail("alice")
+	}
+	th.Reset("alice")
+	if wait := th.Allow("alice"); wait != 0 {
+		t.Errorf("wait after Reset = %v, want none", wait)
+	}
+	th.Fail("alice")
+	if wait := th.Allow("alice"); wait != 0 {
+		t.Errorf("wait after Reset and one failure = %v, want none", wait)
+	}
+}
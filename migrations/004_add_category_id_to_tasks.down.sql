@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tasks_category_id;
+DROP INDEX IF EXISTS idx_tasks_user_id;
+ALTER TABLE tasks DROP COLUMN IF EXISTS category_id;
\ No newline at end of file
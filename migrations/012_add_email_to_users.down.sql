@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS email_verification_tokens;
+DROP INDEX IF EXISTS idx_users_email;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS email;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 4);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_user_id_priority ON tasks(user_id, priority);